@@ -0,0 +1,20 @@
+package main
+
+import "fmt"
+
+// runCommand runs a CLI subcommand such as `chirpy migrate-legacy` instead of
+// starting the server.
+func runCommand(name string, args []string) error {
+	switch name {
+	case "migrate-legacy":
+		return runMigrateLegacy(args)
+	case "snapshot":
+		return runSnapshot(args)
+	case "restore":
+		return runRestore(args)
+	case "create-admin":
+		return runCreateAdmin(args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+)
+
+// startCompactor periodically purges refresh tokens, one-time tokens and
+// login throttles that have expired, so none of them grow without bound.
+func startCompactor(db database.Store, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			purged, err := db.PurgeExpiredRefreshTokens(time.Now().UTC())
+			if err != nil {
+				log.Printf("Couldn't purge expired refresh tokens: %s", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired refresh tokens", purged)
+			}
+			purged, err = db.PurgeExpiredOneTimeTokens(time.Now().UTC())
+			if err != nil {
+				log.Printf("Couldn't purge expired one-time tokens: %s", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired one-time tokens", purged)
+			}
+			purged, err = db.PurgeExpiredLoginThrottles(time.Now().UTC())
+			if err != nil {
+				log.Printf("Couldn't purge expired login throttles: %s", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired login throttles", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+	"github.com/Kristian-Roopnarine/chirpy/internal/validation"
+)
+
+// runCreateAdmin bootstraps the first admin, creating the user or promoting
+// an existing one. Later admins are promoted through PUT
+// /admin/users/{userID}/role, so this refuses to run once an admin exists.
+func runCreateAdmin(args []string) error {
+	driver, path := dbConfig()
+	flags := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	email := flags.String("email", "", "Email of the user to create or promote")
+	flags.Parse(args)
+
+	if *email == "" {
+		return errors.New("create-admin: -email is required")
+	}
+	normalized, err := validation.NormalizeEmail(*email)
+	if err != nil {
+		return fmt.Errorf("create-admin: %w", err)
+	}
+	*email = normalized
+
+	db, err := database.Open(driver, path)
+	if err != nil {
+		return err
+	}
+	users, err := db.ListUsers()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if user.Role == string(auth.RoleAdmin) {
+			return fmt.Errorf("create-admin: %s is already an admin; promote others through the API", user.Email)
+		}
+	}
+
+	user, err := db.GetUserByEmail(*email)
+	if errors.Is(err, database.ErrNotExist) {
+		password := os.Getenv("ADMIN_PASSWORD")
+		if password == "" {
+			return fmt.Errorf("create-admin: no user %s; set ADMIN_PASSWORD to create one", *email)
+		}
+		policy, err := passwordPolicy()
+		if err != nil {
+			return err
+		}
+		err = policy.Check(password, *email)
+		if err != nil {
+			return fmt.Errorf("create-admin: ADMIN_PASSWORD: %w", err)
+		}
+		hashedPassword, err := auth.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		user, err = db.CreateUser(*email, hashedPassword)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created user %d (%s)\n", user.ID, user.Email)
+	} else if err != nil {
+		return err
+	}
+
+	_, err = db.UpdateUserRole(user.ID, string(auth.RoleAdmin))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is now an admin\n", user.Email)
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/validation"
+)
+
+// passwordPolicy starts from validation.DefaultPasswordPolicy and applies
+// PASSWORD_MIN_LENGTH and PASSWORD_MIN_CLASSES. PASSWORD_CHECK_BREACHED=false
+// turns off the breached-password check.
+func passwordPolicy() (validation.PasswordPolicy, error) {
+	policy := validation.DefaultPasswordPolicy
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return validation.PasswordPolicy{}, fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q", v)
+		}
+		policy.MinLength = n
+	}
+	if v := os.Getenv("PASSWORD_MIN_CLASSES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 4 {
+			return validation.PasswordPolicy{}, fmt.Errorf("invalid PASSWORD_MIN_CLASSES %q", v)
+		}
+		policy.MinClasses = n
+	}
+	if os.Getenv("PASSWORD_CHECK_BREACHED") == "false" {
+		policy.RejectBreached = false
+	}
+	return policy, nil
+}
+
+// checkCredentials normalizes email and checks password against the password
+// policy. If either is invalid it responds with the field errors and returns
+// false.
+func (cfg *apiConfig) checkCredentials(w http.ResponseWriter, email, password string) (string, bool) {
+	fields := validation.FieldErrors{}
+	email, err := validation.NormalizeEmail(email)
+	if err != nil {
+		fields["email"] = err.Error()
+	}
+	err = cfg.passwords.Check(password, email)
+	if err != nil {
+		fields["password"] = err.Error()
+	}
+	if len(fields) > 0 {
+		respondWithFieldErrors(w, fields)
+		return "", false
+	}
+	return email, true
+}
+
+// normalizedEmail is email as it would have been stored, for looking users
+// up. Invalid emails are returned trimmed; they won't match anyone.
+func normalizedEmail(email string) string {
+	normalized, err := validation.NormalizeEmail(email)
+	if err != nil {
+		return email
+	}
+	return normalized
+}
@@ -5,5 +5,8 @@ go 1.22.2
 require (
 	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/joho/godotenv v1.5.1
+	github.com/mattn/go-sqlite3 v1.14.22
 	golang.org/x/crypto v0.22.0
 )
+
+require golang.org/x/sys v0.19.0 // indirect
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+)
+
+func (cfg *apiConfig) handlerAdminUsersList(w http.ResponseWriter, r *http.Request) {
+	dbUsers, err := cfg.DB.ListUsers()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list users")
+		return
+	}
+
+	users := []User{}
+	for _, dbUser := range dbUsers {
+		users = append(users, User{
+			ID:            dbUser.ID,
+			Email:         dbUser.Email,
+			IsChirpyRed:   dbUser.IsChirpyRed,
+			Role:          dbUser.Role,
+			EmailVerified: dbUser.EmailVerified,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, users)
+}
+
+func (cfg *apiConfig) handlerAdminUserRoleUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	role, err := auth.ParseRole(params.Role)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Stop the last admin from locking everyone out of the admin routes.
+	if userID == principalFromContext(r.Context()).UserID && role != auth.RoleAdmin {
+		respondWithError(w, http.StatusBadRequest, "Admins can't demote themselves")
+		return
+	}
+
+	user, err := cfg.DB.UpdateUserRole(userID, string(role))
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update role")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, User{
+		ID:            user.ID,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
+	})
+}
+
+// handlerAdminUserUnlock lifts a login lockout early by forgetting the
+// account's failed logins.
+func (cfg *apiConfig) handlerAdminUserUnlock(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	user, err := cfg.DB.GetUser(userID)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+		return
+	}
+
+	err = cfg.DB.ClearLoginFailures(accountThrottleKey(user.Email))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unlock user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerAdminUserAudit(w http.ResponseWriter, r *http.Request) {
+	type auditEvent struct {
+		ID        int       `json:"id"`
+		Action    string    `json:"action"`
+		Fields    []string  `json:"fields"`
+		IP        string    `json:"ip"`
+		UserAgent string    `json:"user_agent"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	_, err = cfg.DB.GetUser(userID)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+		return
+	}
+
+	dbEvents, err := cfg.DB.ListAuditEvents(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't list audit events")
+		return
+	}
+	events := []auditEvent{}
+	for _, event := range dbEvents {
+		events = append(events, auditEvent{
+			ID:        event.ID,
+			Action:    event.Action,
+			Fields:    event.Fields,
+			IP:        event.IP,
+			UserAgent: event.UserAgent,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, events)
+}
@@ -4,10 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"strconv"
 	"strings"
-
-	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
 )
 
 type Chirp struct {
@@ -20,26 +17,14 @@ func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request
 	type parameters struct {
 		Body string `json:"body"`
 	}
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT")
-		return
-	}
-	userIDString, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
-		return
-	}
-
-	userID, err := strconv.Atoi(userIDString)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't convert string to int")
+	principal := principalFromContext(r.Context())
+	if !cfg.requireVerifiedEmail(w, principal) {
 		return
 	}
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode params")
 		return
@@ -50,7 +35,7 @@ func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	chirp, err := cfg.DB.CreateChirp(cleaned, userID)
+	chirp, err := cfg.DB.CreateChirp(cleaned, principal.UserID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp")
 		return
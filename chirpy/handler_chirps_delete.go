@@ -10,23 +10,7 @@ import (
 )
 
 func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request) {
-
-	// get userID from jwt token
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT")
-		return
-	}
-	userIDString, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
-		return
-	}
-	userID, err := strconv.Atoi(userIDString)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "couldn't decode user id")
-		return
-	}
+	principal := principalFromContext(r.Context())
 	chirpIDString := r.PathValue("chirpID")
 	chirpID, err := strconv.Atoi(chirpIDString)
 	if err != nil {
@@ -43,12 +27,14 @@ func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusInternalServerError, "issue finding chirp")
 		return
 	}
-	if chirp.AuthorId != userID {
+	// Moderators can take down anyone's chirps.
+	isModerator := principal.Claims.Role.AtLeast(auth.RoleModerator)
+	if chirp.AuthorId != principal.UserID && !isModerator {
 		respondWithError(w, http.StatusForbidden, "forbidden")
 		return
 	}
 
-	err = cfg.DB.DeleteChirp(chirp.ID, userID)
+	err = cfg.DB.DeleteChirp(chirp.ID, chirp.AuthorId)
 	if err != nil {
 		if errors.Is(err, database.ErrAccessDenied) {
 			respondWithError(w, http.StatusForbidden, "access denied")
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"sort"
 	"strconv"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
 )
 
 func (cfg *apiConfig) handlerChirpsGet(w http.ResponseWriter, r *http.Request) {
@@ -26,31 +28,33 @@ func (cfg *apiConfig) handlerChirpsGet(w http.ResponseWriter, r *http.Request) {
 }
 
 func (cfg *apiConfig) handlerChirpsRetrieve(w http.ResponseWriter, r *http.Request) {
-	dbChirps, err := cfg.DB.GetChirps()
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
-		return
-	}
-	var authorId int
 	_sort := "asc"
 	authorIdString := r.URL.Query().Get("author_id")
 	sortQuery := r.URL.Query().Get("sort")
 	if sortQuery != "" {
 		_sort = sortQuery
 	}
-	filterByAuthorId := authorIdString != ""
-	if filterByAuthorId {
+
+	var dbChirps []database.Chirp
+	var err error
+	if authorIdString != "" {
+		var authorId int
 		authorId, err = strconv.Atoi(authorIdString)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, "error turning author id to int")
 			return
 		}
+		dbChirps, err = cfg.DB.GetChirpsByAuthor(authorId)
+	} else {
+		dbChirps, err = cfg.DB.GetChirps()
 	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		return
+	}
+
 	chirps := []Chirp{}
 	for _, dbChirp := range dbChirps {
-		if filterByAuthorId && dbChirp.AuthorId != authorId {
-			continue
-		}
 		chirps = append(chirps, Chirp{
 			ID:       dbChirp.ID,
 			Body:     dbChirp.Body,
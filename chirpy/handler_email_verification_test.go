@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEmailVerification(t *testing.T) {
+	api := newTestAPI(t)
+	w := api.do("POST", "/api/users", "", map[string]string{"email": "user@example.com", "password": "password"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("couldn't sign up: %d %s", w.Code, w.Body)
+	}
+	token := api.mailToken("user@example.com")
+
+	w = api.do("POST", "/api/email-verification/confirm", "", map[string]string{"token": "unknown"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown token to be rejected, got %d", w.Code)
+	}
+	w = api.do("POST", "/api/email-verification/confirm", "", map[string]string{"token": token})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("couldn't verify email: %d %s", w.Code, w.Body)
+	}
+	w = api.do("POST", "/api/email-verification/confirm", "", map[string]string{"token": token})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a used token to be rejected, got %d", w.Code)
+	}
+
+	user, err := api.cfg.DB.GetUserByEmail("user@example.com")
+	if err != nil || !user.EmailVerified {
+		t.Fatalf("expected the email to be verified, got %+v (%v)", user, err)
+	}
+	w = api.do("POST", "/api/email-verification", api.accessToken(user), nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected resending to a verified email to be 409, got %d", w.Code)
+	}
+}
+
+func TestUnverifiedEmailCantChirpWhenRequired(t *testing.T) {
+	api := newTestAPI(t)
+	api.cfg.emailVerificationRequired = true
+	user := api.createUser("user@example.com", "password")
+	token := api.accessToken(user)
+
+	w := api.do("POST", "/api/chirps", token, map[string]string{"body": "hello"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected an unverified user to be refused, got %d", w.Code)
+	}
+	api.cfg.DB.SetEmailVerified(user.ID)
+	// The token predates verification, so the database is asked.
+	w = api.do("POST", "/api/chirps", token, map[string]string{"body": "hello"})
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected a verified user to chirp, got %d %s", w.Code, w.Body)
+	}
+}
@@ -2,24 +2,56 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
 )
 
+const (
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = time.Hour * 24 * 30 * 6
+	// loginChallengeTTL is how long a user has to enter their TOTP code
+	// after their password.
+	loginChallengeTTL = time.Minute * 5
+)
+
+// challengeResponse is the login response for users with two-factor
+// authentication on. The challenge token and a code are exchanged for
+// tokens at /api/login/totp.
+type challengeResponse struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+}
+
+// dummyPasswordHash is compared against when no user has the email given,
+// so the login takes as long as one with a wrong password. It is hashed with
+// the current policy on first use.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := auth.HashPassword("not a real password")
+	if err != nil {
+		log.Printf("Couldn't hash dummy password: %s", err)
+	}
+	return hash
+})
+
+// accessClaims returns the claims for an access token issued to user.
+func accessClaims(user database.User) auth.Claims {
+	claims := auth.AccessClaims(user.ID, auth.Role(user.Role), user.IsChirpyRed)
+	claims.EmailVerified = user.EmailVerified
+	return claims
+}
+
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Password string `json:"password"`
 		Email    string `json:"email"`
 	}
 
-	type response struct {
-		User
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
-	}
-
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
 	err := decoder.Decode(&params)
@@ -27,23 +59,100 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode params")
 		return
 	}
-	user, err := cfg.DB.GetUserByEmail(params.Email)
+
+	// Throttled attempts are turned away before the password hash compare, so
+	// they stay cheap. Unknown emails are throttled, and compared against a
+	// dummy hash, just like real ones, so neither the status nor the time
+	// taken gives away whether an account exists.
+	ipKey := ipThrottleKey(clientInfo(r).IP)
+	accountKey := accountThrottleKey(params.Email)
+	if !cfg.reserveLoginAttempt(w, ipKey, ipLoginLimit) {
+		return
+	}
+	if !cfg.reserveLoginAttempt(w, accountKey, accountLoginLimit) {
+		cfg.releaseLoginAttempts(ipKey)
+		return
+	}
+	user, err := cfg.DB.GetUserByEmail(normalizedEmail(params.Email))
+	if errors.Is(err, database.ErrNotExist) {
+		auth.CheckPasswordHash(params.Password, dummyPasswordHash())
+		respondWithError(w, http.StatusUnauthorized, "Invalid email or password")
+		return
+	}
 	if err != nil {
+		cfg.releaseLoginAttempts(ipKey, accountKey)
 		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
 		return
 	}
 
 	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid password")
+		respondWithError(w, http.StatusUnauthorized, "Invalid email or password")
+		return
+	}
+	// The password was right, so neither attempt failed. A second factor
+	// reserves attempts of its own.
+	cfg.releaseLoginAttempts(ipKey, accountKey)
+	cfg.rehashPassword(user, params.Password)
+
+	totp, err := cfg.DB.GetTOTP(user.ID)
+	if err != nil && !errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check two-factor authentication")
+		return
+	}
+	if totp.Enabled {
+		challengeToken, err := auth.MakeChallengeToken(user.ID, cfg.tokens, loginChallengeTTL)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create challenge token")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, challengeResponse{
+			MFARequired:    true,
+			ChallengeToken: challengeToken,
+		})
+		return
+	}
+
+	cfg.completeLogin(w, r, user)
+}
+
+// rehashPassword upgrades user's stored hash to the current policy while the
+// plaintext password is at hand. Failures only mean the upgrade waits until
+// the next login.
+func (cfg *apiConfig) rehashPassword(user database.User, password string) {
+	if !auth.PasswordNeedsRehash(user.HashedPassword) {
+		return
+	}
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Couldn't rehash password: %s", err)
 		return
 	}
+	err = cfg.DB.ReplacePasswordHash(user.ID, user.HashedPassword, hashedPassword)
+	if err != nil && !errors.Is(err, database.ErrNotExist) {
+		log.Printf("Couldn't store rehashed password: %s", err)
+	}
+}
+
+// completeLogin starts a session for user and responds with its tokens.
+// Only a finished login resets the account's failed attempts, so guessing
+// TOTP codes still counts after a correct password.
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user database.User) {
+	type response struct {
+		User
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := cfg.DB.ClearLoginFailures(accountThrottleKey(user.Email))
+	if err != nil {
+		log.Printf("Couldn't clear failed logins: %s", err)
+	}
 
 	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
-		time.Hour,
-		auth.TokenTypeAccess,
+		accessClaims(user),
+		cfg.tokens,
+		accessTokenTTL,
 	)
 
 	if err != nil {
@@ -51,22 +160,25 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	refreshToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.jwtSecret,
-		time.Hour*24*30*6,
-		auth.TokenTypeRefresh,
-	)
+	refreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create JWT")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token")
+		return
+	}
+
+	_, err = cfg.DB.CreateRefreshToken(refreshToken, user.ID, time.Now().UTC().Add(refreshTokenTTL), clientInfo(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save session")
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
 		User: User{
-			ID:          user.ID,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
+			ID:            user.ID,
+			Email:         user.Email,
+			IsChirpyRed:   user.IsChirpyRed,
+			Role:          user.Role,
+			EmailVerified: user.EmailVerified,
 		},
 		Token:        accessToken,
 		RefreshToken: refreshToken,
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+	"github.com/Kristian-Roopnarine/chirpy/internal/mailer"
+	"github.com/Kristian-Roopnarine/chirpy/internal/validation"
+)
+
+const passwordResetTTL = time.Hour
+
+// handlerPasswordResetRequest emails a reset link to the user. The lookup and
+// the email happen after the response, so an unknown address can't be told
+// apart from a real one by status or timing.
+func (cfg *apiConfig) handlerPasswordResetRequest(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	go func(email string) {
+		err := cfg.sendPasswordResetEmail(email)
+		if err != nil {
+			log.Printf("Couldn't send password reset email: %s", err)
+		}
+	}(normalizedEmail(params.Email))
+	respondWithJSON(w, http.StatusAccepted, struct{}{})
+}
+
+// sendPasswordResetEmail mails a reset link to the account with email, if
+// there is one.
+func (cfg *apiConfig) sendPasswordResetEmail(email string) error {
+	user, err := cfg.DB.GetUserByEmail(email)
+	if errors.Is(err, database.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := auth.MakeOneTimeToken()
+	if err != nil {
+		return err
+	}
+	err = cfg.DB.CreateOneTimeToken(token, database.PurposePasswordReset, user.ID, time.Now().UTC().Add(passwordResetTTL))
+	if err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password for your Chirpy account.\n\n"+
+				"Reset it here within the next hour:\n%s/reset-password?token=%s\n\n"+
+				"If it wasn't you, you can ignore this email.\n",
+			cfg.publicURL, url.QueryEscape(token),
+		),
+	})
+}
+
+// handlerPasswordResetConfirm sets a new password using a reset token and
+// logs the user out everywhere, in case the old password was compromised.
+func (cfg *apiConfig) handlerPasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	// Looked up before the token is spent, so a rejected password can be
+	// retried with the same link.
+	resetToken, err := cfg.DB.GetOneTimeToken(params.Token, database.PurposePasswordReset)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check reset token")
+		return
+	}
+	user, err := cfg.DB.GetUser(resetToken.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+		return
+	}
+	err = cfg.passwords.Check(params.Password, user.Email)
+	if err != nil {
+		respondWithFieldErrors(w, validation.FieldErrors{"password": err.Error()})
+		return
+	}
+
+	_, err = cfg.DB.ConsumeOneTimeToken(params.Token, database.PurposePasswordReset)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check reset token")
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password")
+		return
+	}
+	client := clientInfo(r)
+	_, err = cfg.DB.PatchUser(user.ID, database.UserUpdate{HashedPassword: &hashedPassword}, database.AuditEvent{
+		Action:    database.AuditPasswordReset,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update password")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
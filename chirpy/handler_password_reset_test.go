@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+	"github.com/Kristian-Roopnarine/chirpy/internal/mailer"
+)
+
+// failingMailer fails every message, after passing it on so tests can wait
+// for it.
+type failingMailer chan mailer.Message
+
+func (m failingMailer) Send(msg mailer.Message) error {
+	m <- msg
+	return errors.New("mail server is down")
+}
+
+func TestPasswordResetRequestLooksTheSameForEveryEmail(t *testing.T) {
+	api := newTestAPI(t)
+	api.createUser("user@example.com", "password")
+
+	for _, email := range []string{"user@example.com", "nobody@example.com"} {
+		w := api.do("POST", "/api/password-reset", "", map[string]string{"email": email})
+		if w.Code != http.StatusAccepted {
+			t.Errorf("%s: expected 202, got %d", email, w.Code)
+		}
+	}
+	if api.mailToken("user@example.com") == "" {
+		t.Error("expected the user to be sent a reset link")
+	}
+}
+
+func TestPasswordResetRequestHidesMailerFailures(t *testing.T) {
+	api := newTestAPI(t)
+	api.createUser("user@example.com", "password")
+	mails := make(failingMailer, 1)
+	api.cfg.mailer = mails
+
+	w := api.do("POST", "/api/password-reset", "", map[string]string{"email": "user@example.com"})
+	if w.Code != http.StatusAccepted {
+		t.Errorf("expected a mailer failure to still be 202, got %d", w.Code)
+	}
+	if msg := <-mails; msg.To != "user@example.com" {
+		t.Errorf("expected a reset email to the user, got %+v", msg)
+	}
+}
+
+func TestPasswordResetConfirm(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("user@example.com", "password")
+	session := api.login("user@example.com", "password")
+
+	api.do("POST", "/api/password-reset", "", map[string]string{"email": "user@EXAMPLE.com"})
+	token := api.mailToken("user@example.com")
+
+	w := api.do("POST", "/api/password-reset/confirm", "", map[string]string{"token": token, "password": "short"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a weak password to be rejected, got %d", w.Code)
+	}
+	w = api.do("POST", "/api/password-reset/confirm", "", map[string]string{"token": token, "password": "new password"})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected the link to still work after a rejected password, got %d %s", w.Code, w.Body)
+	}
+	w = api.do("POST", "/api/password-reset/confirm", "", map[string]string{"token": token, "password": "newer password"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a used link to be rejected, got %d", w.Code)
+	}
+
+	if w = refresh(api, session.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the reset to log out existing sessions, got %d", w.Code)
+	}
+	api.login("user@example.com", "new password")
+
+	events, err := api.cfg.DB.ListAuditEvents(user.ID)
+	if err != nil {
+		t.Fatalf("couldn't list audit events: %v", err)
+	}
+	if len(events) != 1 || events[0].Action != database.AuditPasswordReset {
+		t.Errorf("expected a password reset audit event, got %+v", events)
+	}
+}
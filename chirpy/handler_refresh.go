@@ -1,49 +1,87 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
 )
 
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Coulnd't find JWT")
+		respondWithError(w, http.StatusBadRequest, "Couldn't find refresh token")
 		return
 	}
-	isRevoked, err := cfg.DB.IsTokenRevoked(refreshToken)
+
+	newRefreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token")
+		return
+	}
+
+	rotated, err := cfg.DB.RotateRefreshToken(
+		refreshToken,
+		newRefreshToken,
+		time.Now().UTC().Add(refreshTokenTTL),
+		clientInfo(r),
+	)
 	if err != nil {
+		if errors.Is(err, database.ErrNotExist) {
+			respondWithError(w, http.StatusUnauthorized, "Invalid refresh token")
+			return
+		}
+		if errors.Is(err, database.ErrTokenReused) {
+			respondWithError(w, http.StatusUnauthorized, "Refresh token reuse detected")
+			return
+		}
+		if errors.Is(err, database.ErrTokenRevoked) {
+			respondWithError(w, http.StatusUnauthorized, "Refresh token is revoked")
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Couldn't check session")
 		return
 	}
 
-	if isRevoked {
-		respondWithError(w, http.StatusUnauthorized, "Refresh token is revoked")
+	user, err := cfg.DB.GetUser(rotated.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
 		return
 	}
 
-	accessToken, err := auth.RefreshToken(refreshToken, cfg.jwtSecret)
+	accessToken, err := auth.MakeJWT(
+		accessClaims(user),
+		cfg.tokens,
+		accessTokenTTL,
+	)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create JWT")
 		return
 	}
 	respondWithJSON(w, http.StatusOK, response{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
 	})
 }
 
 func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Couldn't find JWT")
+		respondWithError(w, http.StatusBadRequest, "Couldn't find refresh token")
 		return
 	}
 
-	err = cfg.DB.RevokeToken(refreshToken)
+	err = cfg.DB.RevokeRefreshToken(refreshToken)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token")
 		return
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessionsListAndRevoke(t *testing.T) {
+	api := newTestAPI(t)
+	api.createUser("user@example.com", "password")
+	first := api.login("user@example.com", "password")
+	second := api.login("user@example.com", "password")
+
+	sessions := []Session{}
+	w := api.do("GET", "/api/sessions", first.Token, nil)
+	decodeResponse(t, w, &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %v", sessions)
+	}
+	if sessions[0].IP != "192.0.2.1" {
+		t.Errorf("expected the session to record the peer IP, got %q", sessions[0].IP)
+	}
+
+	w = api.do("DELETE", "/api/sessions/unknown", first.Token, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown session, got %d", w.Code)
+	}
+
+	// Sessions are listed newest first.
+	w = api.do("DELETE", "/api/sessions/"+sessions[0].ID, first.Token, nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("couldn't revoke session: %d %s", w.Code, w.Body)
+	}
+	if w = refresh(api, second.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the revoked session's refresh token to fail, got %d", w.Code)
+	}
+	if w = refresh(api, first.RefreshToken); w.Code != http.StatusOK {
+		t.Errorf("expected the other session to keep working, got %d", w.Code)
+	}
+
+	w = api.do("DELETE", "/api/sessions", first.Token, nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("couldn't revoke sessions: %d %s", w.Code, w.Body)
+	}
+	w = api.do("GET", "/api/sessions", first.Token, nil)
+	decodeResponse(t, w, &sessions)
+	if len(sessions) != 0 {
+		t.Errorf("expected no sessions left, got %v", sessions)
+	}
+}
+
+func TestSessionsAreScopedToTheUser(t *testing.T) {
+	api := newTestAPI(t)
+	api.createUser("user@example.com", "password")
+	other := api.createUser("other@example.com", "password")
+	login := api.login("user@example.com", "password")
+
+	sessions := []Session{}
+	decodeResponse(t, api.do("GET", "/api/sessions", login.Token, nil), &sessions)
+	w := api.do("DELETE", "/api/sessions/"+sessions[0].ID, api.accessToken(other), nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected another user's session to be 404, got %d", w.Code)
+	}
+	if w = refresh(api, login.RefreshToken); w.Code != http.StatusOK {
+		t.Errorf("expected the session to survive, got %d", w.Code)
+	}
+}
+
+// refresh exchanges a refresh token the way clients do, with it as the
+// bearer token.
+func refresh(api *testAPI, refreshToken string) *httptest.ResponseRecorder {
+	return api.do("POST", "/api/refresh", refreshToken, nil)
+}
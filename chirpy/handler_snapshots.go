@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+)
+
+func (cfg *apiConfig) handlerSnapshotCreate(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	snapshot, err := database.TakeSnapshot(cfg.DB, cfg.dbName, cfg.snapshots)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't take snapshot")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, response{
+		Name:      filepath.Base(snapshot.Path),
+		CreatedAt: snapshot.CreatedAt,
+	})
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+)
+
+const totpIssuer = "Chirpy"
+
+// handlerTOTPEnroll starts two-factor enrollment. It isn't enforced until
+// the user confirms a code from their authenticator. The current password is
+// required, so a stolen access token can't attach its own authenticator.
+func (cfg *apiConfig) handlerTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	type response struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(principalFromContext(r.Context()).UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+		return
+	}
+	if !cfg.confirmCurrentPassword(w, r, user, params.CurrentPassword) {
+		return
+	}
+	secret, err := auth.MakeTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create secret")
+		return
+	}
+	err = cfg.DB.StartTOTPEnrollment(user.ID, secret)
+	if errors.Is(err, database.ErrTOTPEnabled) {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start enrollment")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+}
+
+// handlerTOTPVerify enables two-factor authentication once the user sends a
+// valid code, and returns their recovery codes. They are only shown once.
+func (cfg *apiConfig) handlerTOTPVerify(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	userID := principalFromContext(r.Context()).UserID
+	totp, err := cfg.DB.GetTOTP(userID)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Two-factor enrollment not started")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get enrollment")
+		return
+	}
+	if totp.Enabled {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	step, ok := auth.ValidateTOTP(totp.Secret, params.Code, time.Now())
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid code")
+		return
+	}
+
+	recoveryCodes, err := auth.MakeRecoveryCodes()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create recovery codes")
+		return
+	}
+	err = cfg.DB.EnableTOTP(userID, step, recoveryCodes)
+	if errors.Is(err, database.ErrTOTPEnabled) {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't enable two-factor authentication")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{RecoveryCodes: recoveryCodes})
+}
+
+// handlerTOTPDisable turns off two-factor authentication, or abandons an
+// unfinished enrollment, once the user confirms their current password.
+func (cfg *apiConfig) handlerTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CurrentPassword string `json:"current_password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(principalFromContext(r.Context()).UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+		return
+	}
+	if !cfg.confirmCurrentPassword(w, r, user, params.CurrentPassword) {
+		return
+	}
+	err = cfg.DB.DisableTOTP(user.ID)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusNotFound, "Two-factor authentication is not enabled")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't disable two-factor authentication")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerLoginTOTP is the second step of a two-factor login. It takes the
+// challenge token from handlerLogin and either a TOTP code or a recovery
+// code.
+func (cfg *apiConfig) handlerLoginTOTP(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	userID, err := auth.ValidateChallengeToken(params.ChallengeToken, cfg.tokens)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid challenge token")
+		return
+	}
+	user, err := cfg.DB.GetUser(userID)
+	if errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid challenge token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+		return
+	}
+	accountKey := accountThrottleKey(user.Email)
+	ipKey := ipThrottleKey(clientInfo(r).IP)
+	if !cfg.reserveLoginAttempt(w, ipKey, ipLoginLimit) {
+		return
+	}
+	if !cfg.reserveLoginAttempt(w, accountKey, accountLoginLimit) {
+		cfg.releaseLoginAttempts(ipKey)
+		return
+	}
+	// Two-factor may have been turned off since the challenge was issued.
+	totp, err := cfg.DB.GetTOTP(userID)
+	if errors.Is(err, database.ErrNotExist) || err == nil && !totp.Enabled {
+		cfg.releaseLoginAttempts(ipKey, accountKey)
+		respondWithError(w, http.StatusUnauthorized, "Invalid challenge token")
+		return
+	}
+	if err != nil {
+		cfg.releaseLoginAttempts(ipKey, accountKey)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get enrollment")
+		return
+	}
+
+	switch {
+	case params.Code != "":
+		step, ok := auth.ValidateTOTP(totp.Secret, params.Code, time.Now())
+		if !ok {
+			err = database.ErrNotExist
+			break
+		}
+		err = cfg.DB.UseTOTPStep(userID, step)
+	case params.RecoveryCode != "":
+		err = cfg.DB.ConsumeRecoveryCode(userID, auth.NormalizeRecoveryCode(params.RecoveryCode))
+	default:
+		cfg.releaseLoginAttempts(ipKey, accountKey)
+		respondWithError(w, http.StatusBadRequest, "A code or recovery code is required")
+		return
+	}
+	if errors.Is(err, database.ErrTOTPCodeReused) || errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+	if err != nil {
+		cfg.releaseLoginAttempts(ipKey, accountKey)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check code")
+		return
+	}
+
+	cfg.releaseLoginAttempts(ipKey)
+	cfg.completeLogin(w, r, user)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTOTPEnrollNeedsTheCurrentPassword(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("user@example.com", "password")
+	token := api.accessToken(user)
+
+	for _, password := range []string{"", "wrong password"} {
+		w := api.do("POST", "/api/totp", token, map[string]string{"current_password": password})
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%q: expected 403, got %d", password, w.Code)
+		}
+	}
+	w := api.do("POST", "/api/totp", token, map[string]string{"current_password": "password"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("couldn't enroll: %d %s", w.Code, w.Body)
+	}
+	if _, err := api.cfg.DB.GetTOTP(user.ID); err != nil {
+		t.Errorf("expected an enrollment to be started, got %v", err)
+	}
+}
+
+func TestTOTPDisable(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("user@example.com", "password")
+	api.cfg.DB.StartTOTPEnrollment(user.ID, "JBSWY3DPEHPK3PXP")
+	api.cfg.DB.EnableTOTP(user.ID, 0, []string{"aaaaa-aaaaa"})
+
+	challenge := challengeResponse{}
+	w := api.do("POST", "/api/login", "", map[string]string{"email": "user@example.com", "password": "password"})
+	decodeResponse(t, w, &challenge)
+	if !challenge.MFARequired {
+		t.Fatalf("expected a challenge, got %s", w.Body)
+	}
+
+	token := api.accessToken(user)
+	w = api.do("DELETE", "/api/totp", token, map[string]string{"current_password": "wrong password"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected a wrong password to be 403, got %d", w.Code)
+	}
+	w = api.do("DELETE", "/api/totp", token, map[string]string{"current_password": "password"})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("couldn't disable two-factor: %d %s", w.Code, w.Body)
+	}
+	w = api.do("DELETE", "/api/totp", token, map[string]string{"current_password": "password"})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected disabling twice to be 404, got %d", w.Code)
+	}
+
+	w = api.do("POST", "/api/login/totp", "", map[string]string{
+		"challenge_token": challenge.ChallengeToken,
+		"recovery_code":   "aaaaa-aaaaa",
+	})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected an outstanding challenge to be 401, got %d", w.Code)
+	}
+	if login := api.login("user@example.com", "password"); login.Token == "" {
+		t.Error("expected to log in with just a password")
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 
 	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
@@ -10,10 +11,12 @@ import (
 )
 
 type User struct {
-	ID          int    `json:"id"`
-	Email       string `json:"email"`
-	Password    string `json:"-"`
-	IsChirpyRed bool   `json:"is_chirpy_red"`
+	ID            int    `json:"id"`
+	Email         string `json:"email"`
+	Password      string `json:"-"`
+	IsChirpyRed   bool   `json:"is_chirpy_red"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
 }
 
 func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request) {
@@ -32,6 +35,10 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
 		return
 	}
+	email, ok := cfg.checkCredentials(w, params.Email, params.Password)
+	if !ok {
+		return
+	}
 
 	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
@@ -39,7 +46,7 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := cfg.DB.CreateUser(params.Email, hashedPassword)
+	user, err := cfg.DB.CreateUser(email, hashedPassword)
 	if err != nil {
 		if errors.Is(err, database.ErrAlreadyExists) {
 			respondWithError(w, http.StatusConflict, "User already exists")
@@ -49,11 +56,19 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// The account exists either way; the user can ask for another link.
+	err = cfg.sendVerificationEmail(user)
+	if err != nil {
+		log.Printf("Couldn't send verification email: %s", err)
+	}
+
 	respondWithJSON(w, http.StatusCreated, response{
 		User: User{
-			ID:          user.ID,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
+			ID:            user.ID,
+			Email:         user.Email,
+			IsChirpyRed:   user.IsChirpyRed,
+			Role:          user.Role,
+			EmailVerified: user.EmailVerified,
 		},
 	})
 
@@ -2,61 +2,208 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
-	"strconv"
 
 	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+	"github.com/Kristian-Roopnarine/chirpy/internal/validation"
 )
 
+// handlerUsersUpdate replaces the user's email and password. Like PATCH it
+// needs the current password. The password is only checked against the
+// policy, rehashed and sessions revoked if it actually changed.
 func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Password        string `json:"password"`
+		Email           string `json:"email"`
+		CurrentPassword string `json:"current_password"`
 	}
 
-	type response struct {
-		User
+	principal := principalFromContext(r.Context())
+	previous, err := cfg.DB.GetUser(principal.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+		return
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't decode params")
 		return
 	}
-	subject, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	// PUT sends the password even when only the email changes. It is only
+	// held to the password policy when it differs from the current one, so
+	// users with a password from before the policy can still change email.
+	changingPassword := params.Password != params.CurrentPassword
+	fields := validation.FieldErrors{}
+	email, err := validation.NormalizeEmail(params.Email)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
+		fields["email"] = err.Error()
+	}
+	if changingPassword {
+		err = cfg.passwords.Check(params.Password, email)
+		if err != nil {
+			fields["password"] = err.Error()
+		}
+	}
+	if params.CurrentPassword == "" {
+		fields["current_password"] = "Current password is required to change your email or password"
+	}
+	if len(fields) > 0 {
+		respondWithFieldErrors(w, fields)
 		return
 	}
+	if !cfg.confirmCurrentPassword(w, r, previous, params.CurrentPassword) {
+		return
+	}
+
+	update := database.UserUpdate{}
+	if email != previous.Email {
+		update.Email = &email
+	}
+	if changingPassword {
+		hashedPassword, err := auth.HashPassword(params.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't hash password")
+			return
+		}
+		update.HashedPassword = &hashedPassword
+	}
+
+	cfg.applyUserUpdate(w, r, previous, update)
+}
+
+// handlerUsersPatch changes only the fields sent. Changing the email or
+// password needs the current password too, so a stolen access token can't
+// take over the account.
+func (cfg *apiConfig) handlerUsersPatch(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+	}
 
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
-
+	err := decoder.Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode params")
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	principal := principalFromContext(r.Context())
+	previous, err := cfg.DB.GetUser(principal.UserID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
 		return
 	}
 
-	userIDInt, err := strconv.Atoi(subject)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't parse User ID")
+	fields := validation.FieldErrors{}
+	email := previous.Email
+	if params.Email != nil {
+		email, err = validation.NormalizeEmail(*params.Email)
+		if err != nil {
+			fields["email"] = err.Error()
+		}
+	}
+	if params.Password != nil {
+		err = cfg.passwords.Check(*params.Password, email)
+		if err != nil {
+			fields["password"] = err.Error()
+		}
+	}
+	if params.CurrentPassword == "" && (params.Email != nil || params.Password != nil) {
+		fields["current_password"] = "Current password is required to change your email or password"
+	}
+	if len(fields) > 0 {
+		respondWithFieldErrors(w, fields)
 		return
 	}
 
-	user, err := cfg.DB.UpdateUser(userIDInt, params.Email, hashedPassword)
+	if params.Email != nil || params.Password != nil {
+		if !cfg.confirmCurrentPassword(w, r, previous, params.CurrentPassword) {
+			return
+		}
+	}
+
+	update := database.UserUpdate{}
+	if email != previous.Email {
+		update.Email = &email
+	}
+	if params.Password != nil {
+		hashedPassword, err := auth.HashPassword(*params.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't hash password")
+			return
+		}
+		update.HashedPassword = &hashedPassword
+	}
+
+	cfg.applyUserUpdate(w, r, previous, update)
+}
+
+// confirmCurrentPassword checks currentPassword against the user's before an
+// email or password change. A wrong one counts as a failed login, so this
+// can't be used to guess it instead.
+func (cfg *apiConfig) confirmCurrentPassword(w http.ResponseWriter, r *http.Request, user database.User, currentPassword string) bool {
+	accountKey := accountThrottleKey(user.Email)
+	ipKey := ipThrottleKey(clientInfo(r).IP)
+	if !cfg.reserveLoginAttempt(w, ipKey, ipLoginLimit) {
+		return false
+	}
+	if !cfg.reserveLoginAttempt(w, accountKey, accountLoginLimit) {
+		cfg.releaseLoginAttempts(ipKey)
+		return false
+	}
+	err := auth.CheckPasswordHash(currentPassword, user.HashedPassword)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create user")
-		return
+		respondWithError(w, http.StatusForbidden, "Current password is incorrect")
+		return false
+	}
+	cfg.releaseLoginAttempts(ipKey, accountKey)
+	return true
+}
+
+// applyUserUpdate saves update to previous with an audit event and responds
+// with the updated user. PatchUser revokes every session along with a new
+// password, and a new email is sent a verification link.
+func (cfg *apiConfig) applyUserUpdate(w http.ResponseWriter, r *http.Request, previous database.User, update database.UserUpdate) {
+	user := previous
+	if update.Email != nil || update.HashedPassword != nil {
+		client := clientInfo(r)
+		var err error
+		user, err = cfg.DB.PatchUser(previous.ID, update, database.AuditEvent{
+			Action:    database.AuditUserUpdated,
+			IP:        client.IP,
+			UserAgent: client.UserAgent,
+		})
+		if errors.Is(err, database.ErrAlreadyExists) {
+			respondWithError(w, http.StatusConflict, "Email is already in use")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update user")
+			return
+		}
+	}
+
+	if update.Email != nil {
+		err := cfg.sendVerificationEmail(user)
+		if err != nil {
+			log.Printf("Couldn't send verification email: %s", err)
+		}
 	}
 
-	respondWithJSON(w, http.StatusOK, response{
-		User: User{ID: user.ID, Email: user.Email, IsChirpyRed: user.IsChirpyRed},
+	respondWithJSON(w, http.StatusOK, User{
+		ID:            user.ID,
+		Email:         user.Email,
+		IsChirpyRed:   user.IsChirpyRed,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
 	})
 }
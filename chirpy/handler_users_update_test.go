@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+)
+
+func TestPatchUserNeedsTheCurrentPassword(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("user@example.com", "password")
+	token := api.accessToken(user)
+
+	w := api.do("PATCH", "/api/users", token, map[string]string{"email": "new@example.com"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a missing current password to be 400, got %d", w.Code)
+	}
+	w = api.do("PATCH", "/api/users", token, map[string]string{"email": "new@example.com", "current_password": "wrong password"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected a wrong current password to be 403, got %d", w.Code)
+	}
+	w = api.do("PATCH", "/api/users", token, map[string]string{"password": "short", "current_password": "password"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a weak password to be 400, got %d", w.Code)
+	}
+
+	events, _ := api.cfg.DB.ListAuditEvents(user.ID)
+	if len(events) != 0 {
+		t.Errorf("expected refused updates not to be audited, got %+v", events)
+	}
+}
+
+func TestPatchUserIsAudited(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("user@example.com", "password")
+	admin := api.createUser("admin@example.com", "password")
+	admin.Role = string(auth.RoleAdmin)
+	session := api.login("user@example.com", "password")
+
+	w := api.do("PATCH", "/api/users", session.Token, map[string]string{"email": "new@example.com", "current_password": "password"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("couldn't change email: %d %s", w.Code, w.Body)
+	}
+	if w = refresh(api, session.RefreshToken); w.Code != http.StatusOK {
+		t.Fatalf("expected a new email to keep sessions, got %d", w.Code)
+	}
+	decodeResponse(t, w, &session)
+	if api.mailToken("new@example.com") == "" {
+		t.Error("expected the new email to be sent a verification link")
+	}
+
+	w = api.do("PATCH", "/api/users", session.Token, map[string]string{"password": "fresh password", "current_password": "password"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("couldn't change password: %d %s", w.Code, w.Body)
+	}
+	if w = refresh(api, session.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a new password to revoke sessions, got %d", w.Code)
+	}
+
+	events := []database.AuditEvent{}
+	w = api.do("GET", "/admin/users/"+strconv.Itoa(user.ID)+"/audit", api.accessToken(admin), nil)
+	decodeResponse(t, w, &events)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 audit events, got %+v", events)
+	}
+	for i, fields := range [][]string{{"email"}, {"password"}} {
+		event := events[i]
+		if event.Action != database.AuditUserUpdated || !slices.Equal(event.Fields, fields) || event.IP != "192.0.2.1" {
+			t.Errorf("expected event %d to record %v from the client, got %+v", i, fields, event)
+		}
+	}
+}
+
+func TestPutUserKeepsAnUnchangedPassword(t *testing.T) {
+	api := newTestAPI(t)
+	// From before the password policy.
+	user := api.createUser("user@example.com", "short")
+	session := api.login("user@example.com", "short")
+
+	w := api.do("PUT", "/api/users", api.accessToken(user), map[string]string{
+		"email":            "new@example.com",
+		"password":         "short",
+		"current_password": "short",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected an email change to skip the password policy, got %d %s", w.Code, w.Body)
+	}
+	if w = refresh(api, session.RefreshToken); w.Code != http.StatusOK {
+		t.Errorf("expected an unchanged password to keep sessions, got %d", w.Code)
+	}
+	events, _ := api.cfg.DB.ListAuditEvents(user.ID)
+	if len(events) != 1 || !slices.Equal(events[0].Fields, []string{"email"}) {
+		t.Errorf("expected only the email to be audited, got %+v", events)
+	}
+}
@@ -1,118 +1,199 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type TokenType string
 
 const (
-	TokenTypeAccess  TokenType = "chirpy-access"
-	TokenTypeRefresh TokenType = "chirpy-refresh"
+	TokenTypeAccess TokenType = "chirpy-access"
+	// TokenTypeChallenge is issued after the password step of a two-factor
+	// login. It only proves the password was right and grants nothing.
+	TokenTypeChallenge TokenType = "chirpy-mfa-challenge"
 )
 
 var ErrNoAuthHeaderIncluded = errors.New("not auth header included in request")
 
-func HashPassword(password string) (string, error) {
-	dat, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(dat), nil
+// TokenConfig is what access tokens are signed with and checked against.
+// Issuer and Audience are set on every token and required when validating,
+// so services verifying tokens through the JWKS can check them too.
+type TokenConfig struct {
+	Keys     *Keyring
+	Issuer   string
+	Audience string
 }
 
-func CheckPasswordHash(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-}
+// Scopes limit what an access token may be used for.
+const (
+	ScopeChirpsWrite = "chirps:write"
+	ScopeAccount     = "account"
+)
 
-func MakeJWT(userID int, tokenSecret string, expiresIn time.Duration, tokenType TokenType) (string, error) {
-	signingKey := []byte(tokenSecret)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    string(tokenType),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   fmt.Sprintf("%d", userID),
-	})
-	return token.SignedString(signingKey)
+// DefaultScopes are granted to tokens issued at login.
+var DefaultScopes = []string{ScopeChirpsWrite, ScopeAccount}
+
+// Claims are the claims of a Chirpy access token. Role, IsChirpyRed and
+// EmailVerified are snapshots taken when the token was issued, so they can
+// lag the database by up to the token's lifetime.
+type Claims struct {
+	TokenType     TokenType `json:"token_type"`
+	Scope         []string  `json:"scope,omitempty"`
+	Role          Role      `json:"role"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
+	jwt.RegisteredClaims
 }
 
-func RefreshToken(tokenString, tokenSecret string) (string, error) {
-	claimStruct := jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(
-		tokenString,
-		&claimStruct,
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(tokenSecret), nil
+// AccessClaims returns the claims for a user's access token with the
+// default scopes.
+func AccessClaims(userID int, role Role, isChirpyRed bool) Claims {
+	return Claims{
+		TokenType:   TokenTypeAccess,
+		Scope:       DefaultScopes,
+		Role:        role,
+		IsChirpyRed: isChirpyRed,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: strconv.Itoa(userID),
 		},
-	)
-	if err != nil {
-		return "", err
 	}
+}
 
-	userIDString, err := token.Claims.GetSubject()
+// UserID returns the user the token was issued to.
+func (c Claims) UserID() (int, error) {
+	userID, err := strconv.Atoi(c.Subject)
 	if err != nil {
-		return "", err
+		return 0, fmt.Errorf("invalid subject %q", c.Subject)
 	}
+	return userID, nil
+}
 
-	issuer, err := token.Claims.GetIssuer()
-	if err != nil {
-		return "", err
-	}
-	if issuer != string(TokenTypeRefresh) {
-		return "", errors.New("invalid issuer")
-	}
+func (c Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scope, scope)
+}
 
-	userID, err := strconv.Atoi(userIDString)
+// MakeJWT signs claims, filling in the token ID, issuer, audience and
+// timestamps.
+func MakeJWT(claims Claims, cfg TokenConfig, expiresIn time.Duration) (string, error) {
+	keyID, signingKey := cfg.Keys.signingKey()
+	tokenID, err := makeTokenID()
 	if err != nil {
 		return "", err
 	}
+	now := time.Now().UTC()
+	claims.ID = tokenID
+	claims.Issuer = cfg.Issuer
+	claims.Audience = jwt.ClaimStrings{cfg.Audience}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(expiresIn))
+
+	token := jwt.NewWithClaims(signingKey.method, claims)
+	token.Header["kid"] = keyID
+	return token.SignedString(signingKey.private)
+}
 
-	newToken, err := MakeJWT(
-		userID,
-		tokenSecret,
-		time.Hour,
-		TokenTypeAccess,
-	)
+// MakeChallengeToken returns a token that lets userID finish a two-factor
+// login within expiresIn.
+func MakeChallengeToken(userID int, cfg TokenConfig, expiresIn time.Duration) (string, error) {
+	return MakeJWT(Claims{
+		TokenType: TokenTypeChallenge,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: strconv.Itoa(userID),
+		},
+	}, cfg, expiresIn)
+}
+
+// ValidateChallengeToken verifies a challenge token and returns the user it
+// was issued to.
+func ValidateChallengeToken(tokenString string, cfg TokenConfig) (int, error) {
+	claims, err := parseJWT(tokenString, cfg, TokenTypeChallenge)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
-	return newToken, nil
+	return claims.UserID()
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (string, error) {
-	claimStruct := jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(
+// ValidateJWT verifies an access token and returns its claims.
+func ValidateJWT(tokenString string, cfg TokenConfig) (Claims, error) {
+	return parseJWT(tokenString, cfg, TokenTypeAccess)
+}
+
+func parseJWT(tokenString string, cfg TokenConfig, tokenType TokenType) (Claims, error) {
+	claims := Claims{}
+	_, err := jwt.ParseWithClaims(
 		tokenString,
-		&claimStruct,
+		&claims,
 		func(token *jwt.Token) (interface{}, error) {
-			return []byte(tokenSecret), nil
+			keyID, _ := token.Header["kid"].(string)
+			if keyID == "" {
+				keyID = LegacyKeyID
+			}
+			key, err := cfg.Keys.verificationKey(keyID)
+			if err != nil {
+				return nil, err
+			}
+			if token.Method.Alg() != key.method.Alg() {
+				return nil, fmt.Errorf("key %q does not sign %s tokens", keyID, token.Method.Alg())
+			}
+			return key.public, nil
 		},
+		jwt.WithValidMethods([]string{
+			jwt.SigningMethodHS256.Alg(),
+			jwt.SigningMethodEdDSA.Alg(),
+			jwt.SigningMethodRS256.Alg(),
+		}),
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithAudience(cfg.Audience),
+		jwt.WithExpirationRequired(),
 	)
 	if err != nil {
-		return "", err
+		return Claims{}, err
 	}
-
-	userIDString, err := token.Claims.GetSubject()
+	if claims.TokenType != tokenType {
+		return Claims{}, errors.New("invalid token type")
+	}
+	_, err = claims.UserID()
 	if err != nil {
-		return "", err
+		return Claims{}, err
 	}
+	return claims, nil
+}
 
-	issuer, err := token.Claims.GetIssuer()
+// makeTokenID returns a random jti so two tokens issued to the same user in
+// the same second are still distinct.
+func makeTokenID() (string, error) {
+	return randomHex(16)
+}
+
+// MakeRefreshToken returns a random opaque refresh token. Refresh tokens
+// carry no claims; the database holds everything known about them.
+func MakeRefreshToken() (string, error) {
+	return randomHex(32)
+}
+
+// MakeOneTimeToken returns a random token for single-use links such as
+// password resets.
+func MakeOneTimeToken() (string, error) {
+	return randomHex(32)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
 	if err != nil {
 		return "", err
 	}
-	if issuer != string(TokenTypeAccess) {
-		return "", errors.New("invalid issuer")
-	}
-	return userIDString, nil
+	return hex.EncodeToString(b), nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateJWTReturnsClaims(t *testing.T) {
+	keys, err := NewKeyring([]Key{{ID: LegacyKeyID, Secret: "secret"}}, LegacyKeyID)
+	if err != nil {
+		t.Fatalf("couldn't create keyring: %v", err)
+	}
+	cfg := testTokenConfig(keys)
+
+	token, err := MakeJWT(AccessClaims(42, RoleAdmin, true), cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("couldn't make token: %v", err)
+	}
+	claims, err := ValidateJWT(token, cfg)
+	if err != nil {
+		t.Fatalf("expected token to verify, got %v", err)
+	}
+	userID, err := claims.UserID()
+	if err != nil || userID != 42 {
+		t.Errorf("expected user 42, got %d (%v)", userID, err)
+	}
+	if claims.Role != RoleAdmin {
+		t.Errorf("expected role %q, got %q", RoleAdmin, claims.Role)
+	}
+	if !claims.IsChirpyRed {
+		t.Error("expected is_chirpy_red to round-trip")
+	}
+	if !claims.HasScope(ScopeChirpsWrite) || claims.HasScope("admin") {
+		t.Errorf("unexpected scopes %v", claims.Scope)
+	}
+
+	other := cfg
+	other.Audience = "another-service"
+	_, err = ValidateJWT(token, other)
+	if err == nil {
+		t.Error("expected a token for another audience to be rejected")
+	}
+
+	notAccess := AccessClaims(42, RoleUser, false)
+	notAccess.TokenType = "chirpy-refresh"
+	token, err = MakeJWT(notAccess, cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("couldn't make token: %v", err)
+	}
+	_, err = ValidateJWT(token, cfg)
+	if err == nil {
+		t.Error("expected a token that isn't an access token to be rejected")
+	}
+}
+
+func TestRoleHierarchy(t *testing.T) {
+	if !RoleAdmin.AtLeast(RoleModerator) || !RoleModerator.AtLeast(RoleUser) {
+		t.Error("expected higher roles to include lower ones")
+	}
+	if RoleUser.AtLeast(RoleModerator) {
+		t.Error("expected user not to include moderator")
+	}
+	if Role("").AtLeast(RoleUser) {
+		t.Error("expected an unknown role to grant nothing")
+	}
+}
+
+func TestChallengeTokenIsNotAnAccessToken(t *testing.T) {
+	keys, err := NewKeyring([]Key{{ID: LegacyKeyID, Secret: "secret"}}, LegacyKeyID)
+	if err != nil {
+		t.Fatalf("couldn't create keyring: %v", err)
+	}
+	cfg := testTokenConfig(keys)
+
+	challenge, err := MakeChallengeToken(42, cfg, time.Minute)
+	if err != nil {
+		t.Fatalf("couldn't make challenge token: %v", err)
+	}
+	userID, err := ValidateChallengeToken(challenge, cfg)
+	if err != nil || userID != 42 {
+		t.Errorf("expected user 42, got %d (%v)", userID, err)
+	}
+	_, err = ValidateJWT(challenge, cfg)
+	if err == nil {
+		t.Error("expected a challenge token to be rejected as an access token")
+	}
+
+	access, err := MakeJWT(AccessClaims(42, RoleUser, false), cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("couldn't make token: %v", err)
+	}
+	_, err = ValidateChallengeToken(access, cfg)
+	if err == nil {
+		t.Error("expected an access token to be rejected as a challenge token")
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestEd25519TokensVerifyWithPublishedKey(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewKeyring([]Key{
+		{ID: "hmac", Secret: "secret"},
+		{ID: "ed", PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))},
+	}, "ed")
+	if err != nil {
+		t.Fatalf("couldn't create keyring: %v", err)
+	}
+	cfg := testTokenConfig(keys)
+
+	token, err := MakeJWT(AccessClaims(1, RoleUser, false), cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("couldn't make token: %v", err)
+	}
+	_, err = ValidateJWT(token, cfg)
+	if err != nil {
+		t.Fatalf("expected token to verify, got %v", err)
+	}
+
+	set := keys.JWKS()
+	if len(set.Keys) != 1 || set.Keys[0].KeyID != "ed" {
+		t.Fatalf("expected only the Ed25519 key to be published, got %+v", set.Keys)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(set.Keys[0].X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !public.Equal(ed25519.PublicKey(x)) {
+		t.Fatal("published key does not match the signing key")
+	}
+	_, err = jwt.Parse(token, func(*jwt.Token) (interface{}, error) {
+		return ed25519.PublicKey(x), nil
+	}, jwt.WithValidMethods([]string{"EdDSA"}), jwt.WithIssuer(cfg.Issuer), jwt.WithAudience(cfg.Audience))
+	if err != nil {
+		t.Errorf("expected a downstream verifier to accept the token, got %v", err)
+	}
+}
+
+func TestTokenMustMatchKeyAlgorithm(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewKeyring([]Key{
+		{ID: "ed", PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))},
+	}, "ed")
+	if err != nil {
+		t.Fatalf("couldn't create keyring: %v", err)
+	}
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		TokenType: TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://chirpy.test",
+			Audience:  jwt.ClaimStrings{"chirpy"},
+			Subject:   "1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	forged.Header["kid"] = "ed"
+	tokenString, err := forged.SignedString([]byte("guess"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ValidateJWT(tokenString, testTokenConfig(keys))
+	if err == nil {
+		t.Error("expected an HS256 token naming an Ed25519 key to be rejected")
+	}
+}
@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// LegacyKeyID is the key that verifies tokens issued before tokens carried a
+// kid header. A keyring built from JWT_SECRET uses it for its only key.
+const LegacyKeyID = "default"
+
+const minRSAKeyBits = 2048
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is one signing key: either an HS256 Secret or a PEM-encoded Ed25519
+// or RSA PrivateKey, which sign EdDSA and RS256 tokens respectively.
+type Key struct {
+	ID         string `json:"id"`
+	Secret     string `json:"secret,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+}
+
+// Keyring holds the keys tokens are verified with and names the one new
+// tokens are signed with. Keys are rotated by adding a new key, making it
+// active, and removing the old one once every token it signed has expired.
+type Keyring struct {
+	mu     sync.RWMutex
+	keys   map[string]signingKey
+	active string
+}
+
+type signingKey struct {
+	method jwt.SigningMethod
+	// private signs tokens and public verifies them. For HS256 both are
+	// the secret.
+	private any
+	public  any
+}
+
+// keyFile is the layout of a keyring file.
+type keyFile struct {
+	Active string `json:"active"`
+	Keys   []Key  `json:"keys"`
+}
+
+// NewKeyring returns a keyring that signs with the key named active.
+func NewKeyring(keys []Key, active string) (*Keyring, error) {
+	k := &Keyring{}
+	err := k.set(keys, active)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// LoadKeyring reads a keyring from path. See Reload for the formats.
+func LoadKeyring(path string) (*Keyring, error) {
+	k := &Keyring{}
+	err := k.Reload(path)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload replaces the keys with those at path. A file holds
+// {"active": kid, "keys": [{"id": kid, "secret": ...}]}. A directory holds
+// one <kid>.key file per HS256 secret or <kid>.pem file per private key, and
+// the key whose ID sorts last is active, so date-named keys rotate by
+// dropping in a newer file. On error the current keys are kept.
+func (k *Keyring) Reload(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	keys := []Key{}
+	active := ""
+	if info.IsDir() {
+		keys, active, err = readKeyDir(path)
+	} else {
+		keys, active, err = readKeyFile(path)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't load keys from %s: %w", path, err)
+	}
+	return k.set(keys, active)
+}
+
+// ActiveKeyID returns the ID of the key new tokens are signed with.
+func (k *Keyring) ActiveKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+func (k *Keyring) signingKey() (string, signingKey) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active, k.keys[k.active]
+}
+
+func (k *Keyring) verificationKey(id string) (signingKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[id]
+	if !ok {
+		return signingKey{}, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+func (k *Keyring) set(keys []Key, active string) error {
+	parsed := map[string]signingKey{}
+	for _, key := range keys {
+		if key.ID == "" {
+			return errors.New("key is missing an id")
+		}
+		if _, ok := parsed[key.ID]; ok {
+			return fmt.Errorf("duplicate key %q", key.ID)
+		}
+		signing, err := parseKey(key)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", key.ID, err)
+		}
+		parsed[key.ID] = signing
+	}
+	if _, ok := parsed[active]; !ok {
+		return fmt.Errorf("active key %q is not in the keyring", active)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = parsed
+	k.active = active
+	return nil
+}
+
+func parseKey(key Key) (signingKey, error) {
+	switch {
+	case key.Secret != "" && key.PrivateKey != "":
+		return signingKey{}, errors.New("has both a secret and a private key")
+	case key.Secret != "":
+		secret := []byte(key.Secret)
+		return signingKey{method: jwt.SigningMethodHS256, private: secret, public: secret}, nil
+	case key.PrivateKey != "":
+		return parsePrivateKey([]byte(key.PrivateKey))
+	default:
+		return signingKey{}, errors.New("has no secret or private key")
+	}
+}
+
+func parsePrivateKey(dat []byte) (signingKey, error) {
+	block, _ := pem.Decode(dat)
+	if block == nil {
+		return signingKey{}, errors.New("private key is not PEM encoded")
+	}
+	var private any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return signingKey{}, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	switch private := private.(type) {
+	case ed25519.PrivateKey:
+		return signingKey{method: jwt.SigningMethodEdDSA, private: private, public: private.Public()}, nil
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < minRSAKeyBits {
+			return signingKey{}, fmt.Errorf("RSA key is %d bits, need at least %d", private.N.BitLen(), minRSAKeyBits)
+		}
+		return signingKey{method: jwt.SigningMethodRS256, private: private, public: &private.PublicKey}, nil
+	default:
+		return signingKey{}, fmt.Errorf("unsupported private key type %T", private)
+	}
+}
+
+func readKeyFile(path string) ([]Key, string, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	file := keyFile{}
+	err = json.Unmarshal(dat, &file)
+	if err != nil {
+		return nil, "", err
+	}
+	return file.Keys, file.Active, nil
+}
+
+func readKeyDir(dir string) ([]Key, string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	keys := []Key{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".key" && ext != ".pem") {
+			continue
+		}
+		dat, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, "", err
+		}
+		key := Key{ID: strings.TrimSuffix(entry.Name(), ext)}
+		if ext == ".pem" {
+			key.PrivateKey = string(dat)
+		} else {
+			key.Secret = strings.TrimSpace(string(dat))
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, "", errors.New("no .key or .pem files")
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, keys[len(keys)-1].ID, nil
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatedKeysStillVerifyOldTokens(t *testing.T) {
+	keys, err := NewKeyring([]Key{{ID: "2026-01", Secret: "old"}}, "2026-01")
+	if err != nil {
+		t.Fatalf("couldn't create keyring: %v", err)
+	}
+	cfg := testTokenConfig(keys)
+	oldToken, err := MakeJWT(AccessClaims(1, RoleUser, false), cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("couldn't make token: %v", err)
+	}
+
+	dir := t.TempDir()
+	writeKey(t, dir, "2026-01", "old")
+	writeKey(t, dir, "2026-02", "new")
+	err = keys.Reload(dir)
+	if err != nil {
+		t.Fatalf("couldn't reload keyring: %v", err)
+	}
+	if keys.ActiveKeyID() != "2026-02" {
+		t.Fatalf("expected the newest key to be active, got %q", keys.ActiveKeyID())
+	}
+	newToken, err := MakeJWT(AccessClaims(1, RoleUser, false), cfg, time.Hour)
+	if err != nil {
+		t.Fatalf("couldn't make token: %v", err)
+	}
+	for _, token := range []string{oldToken, newToken} {
+		_, err = ValidateJWT(token, cfg)
+		if err != nil {
+			t.Errorf("expected token to verify, got %v", err)
+		}
+	}
+
+	err = os.Remove(filepath.Join(dir, "2026-01.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = keys.Reload(dir)
+	if err != nil {
+		t.Fatalf("couldn't reload keyring: %v", err)
+	}
+	_, err = ValidateJWT(oldToken, cfg)
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected a token signed by a retired key to fail, got %v", err)
+	}
+	_, err = ValidateJWT(newToken, cfg)
+	if err != nil {
+		t.Errorf("expected token to verify, got %v", err)
+	}
+}
+
+func TestFailedReloadKeepsKeys(t *testing.T) {
+	keys, err := NewKeyring([]Key{{ID: LegacyKeyID, Secret: "secret"}}, LegacyKeyID)
+	if err != nil {
+		t.Fatalf("couldn't create keyring: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "keys.json")
+	err = os.WriteFile(path, []byte(`{"active": "missing", "keys": [{"id": "a", "secret": "x"}]}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = keys.Reload(path)
+	if err == nil {
+		t.Fatal("expected a keyring without its active key to be rejected")
+	}
+	if keys.ActiveKeyID() != LegacyKeyID {
+		t.Errorf("expected the old keys to be kept, got active key %q", keys.ActiveKeyID())
+	}
+}
+
+func writeKey(t *testing.T, dir, id, secret string) {
+	t.Helper()
+	err := os.WriteFile(filepath.Join(dir, id+".key"), []byte(secret+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testTokenConfig(keys *Keyring) TokenConfig {
+	return TokenConfig{
+		Keys:     keys,
+		Issuer:   "https://chirpy.test",
+		Audience: "chirpy",
+	}
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hash algorithms. Hashes carry their algorithm and parameters, so
+// a hash made under an older policy still verifies after the policy changes.
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var ErrPasswordMismatch = errors.New("password does not match hash")
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Argon2Params are argon2id's cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// PasswordHasher hashes new passwords under one policy and verifies hashes
+// made under any policy.
+type PasswordHasher struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+// DefaultPasswordHasher is the current policy: argon2id with OWASP's
+// recommended minimum parameters. Unlike bcrypt it has no input length limit.
+var DefaultPasswordHasher = PasswordHasher{
+	Algorithm: AlgorithmArgon2id,
+	Argon2: Argon2Params{
+		Memory:  19 * 1024,
+		Time:    2,
+		Threads: 1,
+		SaltLen: 16,
+		KeyLen:  32,
+	},
+	BcryptCost: bcrypt.DefaultCost,
+}
+
+func HashPassword(password string) (string, error) {
+	return DefaultPasswordHasher.Hash(password)
+}
+
+func CheckPasswordHash(password, hash string) error {
+	return DefaultPasswordHasher.Check(password, hash)
+}
+
+// PasswordNeedsRehash reports whether hash should be replaced with one made
+// under the current policy the next time the password is known.
+func PasswordNeedsRehash(hash string) bool {
+	return DefaultPasswordHasher.NeedsRehash(hash)
+}
+
+func (h PasswordHasher) Hash(password string) (string, error) {
+	switch h.Algorithm {
+	case AlgorithmArgon2id:
+		salt := make([]byte, h.Argon2.SaltLen)
+		_, err := rand.Read(salt)
+		if err != nil {
+			return "", err
+		}
+		p := h.Argon2
+		key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+		return fmt.Sprintf(
+			"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, p.Memory, p.Time, p.Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	case AlgorithmBcrypt:
+		// bcrypt only reads the first 72 bytes; refuse rather than
+		// silently ignore the rest.
+		dat, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(dat), nil
+	default:
+		return "", fmt.Errorf("unknown password hash algorithm %q", h.Algorithm)
+	}
+}
+
+// Check returns nil if password matches hash, ErrPasswordMismatch if it
+// doesn't, or another error if hash can't be read.
+func (h PasswordHasher) Check(password, hash string) error {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		version, p, salt, key, err := parseArgon2Hash(hash)
+		if err != nil {
+			return err
+		}
+		if version != argon2.Version {
+			return fmt.Errorf("unsupported argon2 version %d", version)
+		}
+		got := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+		if subtle.ConstantTimeCompare(got, key) != 1 {
+			return ErrPasswordMismatch
+		}
+		return nil
+	case isBcryptHash(hash):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+		return err
+	default:
+		return ErrUnknownHash
+	}
+}
+
+// NeedsRehash reports whether hash uses another algorithm than h, or weaker
+// parameters.
+func (h PasswordHasher) NeedsRehash(hash string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		if h.Algorithm != AlgorithmArgon2id {
+			return true
+		}
+		version, p, _, _, err := parseArgon2Hash(hash)
+		if err != nil {
+			return false
+		}
+		return version != argon2.Version ||
+			p.Memory < h.Argon2.Memory ||
+			p.Time < h.Argon2.Time ||
+			p.Threads < h.Argon2.Threads ||
+			p.KeyLen < h.Argon2.KeyLen
+	case isBcryptHash(hash):
+		if h.Algorithm != AlgorithmBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err == nil && cost < h.BcryptCost
+	default:
+		return false
+	}
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// parseArgon2Hash reads a hash in the PHC string format,
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>.
+func parseArgon2Hash(hash string) (int, Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return 0, Argon2Params{}, nil, nil, ErrUnknownHash
+	}
+	version := 0
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return 0, Argon2Params{}, nil, nil, ErrUnknownHash
+	}
+	p := Argon2Params{}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads)
+	if err != nil {
+		return 0, Argon2Params{}, nil, nil, ErrUnknownHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return 0, Argon2Params{}, nil, nil, ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return 0, Argon2Params{}, nil, nil, ErrUnknownHash
+	}
+	p.SaltLen = uint32(len(salt))
+	p.KeyLen = uint32(len(key))
+	return version, p, salt, key, nil
+}
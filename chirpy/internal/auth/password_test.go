@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testHasher is argon2id with cheap parameters so the tests stay fast.
+var testHasher = PasswordHasher{
+	Algorithm:  AlgorithmArgon2id,
+	Argon2:     Argon2Params{Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32},
+	BcryptCost: bcrypt.MinCost,
+}
+
+func TestArgon2idHashRoundTrips(t *testing.T) {
+	// Past bcrypt's 72-byte limit, only the tail differs.
+	password := strings.Repeat("a", 80) + "b"
+	hash, err := testHasher.Hash(password)
+	if err != nil {
+		t.Fatalf("couldn't hash password: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("expected the parameters in the hash, got %q", hash)
+	}
+	err = testHasher.Check(password, hash)
+	if err != nil {
+		t.Errorf("expected password to match, got %v", err)
+	}
+	err = testHasher.Check(strings.Repeat("a", 80)+"c", hash)
+	if !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("expected a mismatch, got %v", err)
+	}
+	if testHasher.NeedsRehash(hash) {
+		t.Error("expected a hash made under the current policy not to need a rehash")
+	}
+
+	stronger := testHasher
+	stronger.Argon2.Memory *= 2
+	if !stronger.NeedsRehash(hash) {
+		t.Error("expected a hash with less memory than the policy to need a rehash")
+	}
+}
+
+func TestBcryptHashesStillVerifyAndGetRehashed(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("couldn't hash password: %v", err)
+	}
+	err = testHasher.Check("password", string(legacy))
+	if err != nil {
+		t.Errorf("expected a bcrypt hash to verify, got %v", err)
+	}
+	err = testHasher.Check("wrong", string(legacy))
+	if !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("expected a mismatch, got %v", err)
+	}
+	if !testHasher.NeedsRehash(string(legacy)) {
+		t.Error("expected a bcrypt hash to need a rehash under an argon2id policy")
+	}
+
+	bcryptHasher := PasswordHasher{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost + 1}
+	if !bcryptHasher.NeedsRehash(string(legacy)) {
+		t.Error("expected a cheaper bcrypt hash to need a rehash")
+	}
+	_, err = bcryptHasher.Hash(strings.Repeat("a", 73))
+	if err == nil {
+		t.Error("expected bcrypt to refuse a password over 72 bytes")
+	}
+}
+
+func TestCheckRejectsUnknownHashes(t *testing.T) {
+	for _, hash := range []string{"", "plaintext", "$argon2id$v=19$garbage"} {
+		err := testHasher.Check("password", hash)
+		if !errors.Is(err, ErrUnknownHash) {
+			t.Errorf("expected %q to be rejected as unknown, got %v", hash, err)
+		}
+	}
+}
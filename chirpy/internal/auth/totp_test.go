@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"testing"
+	"time"
+)
+
+// TestTOTPVectors checks hotp against the test vectors in RFC 6238,
+// appendix B.
+func TestTOTPVectors(t *testing.T) {
+	seeds := map[string][]byte{
+		"SHA1":   []byte("12345678901234567890"),
+		"SHA256": []byte("12345678901234567890123456789012"),
+		"SHA512": []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	hashes := map[string]func() hash.Hash{
+		"SHA1":   sha1.New,
+		"SHA256": sha256.New,
+		"SHA512": sha512.New,
+	}
+	vectors := []struct {
+		unix int64
+		alg  string
+		code string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+	for _, v := range vectors {
+		step := totpStep(time.Unix(v.unix, 0), totpPeriod)
+		got := hotp(seeds[v.alg], uint64(step), 8, hashes[v.alg])
+		if got != v.code {
+			t.Errorf("%s at %d: expected %s, got %s", v.alg, v.unix, v.code, got)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+	// The six-digit code is the last six digits of the RFC's eight-digit one.
+	step, ok := ValidateTOTP(secret, "081804", now)
+	if !ok || step != totpStep(now, totpPeriod) {
+		t.Fatalf("expected the current code to validate, got step %d, %v", step, ok)
+	}
+	_, ok = ValidateTOTP(secret, "081804", now.Add(totpPeriod))
+	if !ok {
+		t.Error("expected the previous period's code to still validate")
+	}
+	_, ok = ValidateTOTP(secret, "081804", now.Add(3*totpPeriod))
+	if ok {
+		t.Error("expected a code three periods old to be rejected")
+	}
+	_, ok = ValidateTOTP(secret, "000000", now)
+	if ok {
+		t.Error("expected a wrong code to be rejected")
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	codes, err := MakeRecoveryCodes()
+	if err != nil {
+		t.Fatalf("couldn't make recovery codes: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("expected %d codes, got %d", recoveryCodeCount, len(codes))
+	}
+	for _, code := range codes {
+		if NormalizeRecoveryCode(code) != code {
+			t.Errorf("expected %q to already be normalized", code)
+		}
+	}
+	if got := NormalizeRecoveryCode(" AB12C34D5E "); got != "ab12c-34d5e" {
+		t.Errorf("expected ab12c-34d5e, got %q", got)
+	}
+}
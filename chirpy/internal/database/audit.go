@@ -0,0 +1,51 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// Audit actions.
+const (
+	AuditUserUpdated   = "user.updated"
+	AuditPasswordReset = "user.password_reset"
+)
+
+// AuditEvent records a change to a user's account: which fields changed,
+// never their values, and the client that changed them.
+type AuditEvent struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Action    string    `json:"action"`
+	Fields    []string  `json:"fields"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListAuditEvents returns the events recorded for the user, oldest first.
+func (db *DB) ListAuditEvents(userID int) ([]AuditEvent, error) {
+	events := []AuditEvent{}
+	err := db.View(func(tx *DBStructure) error {
+		for _, event := range tx.AuditEvents {
+			if event.UserID == userID {
+				events = append(events, event)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	return events, nil
+}
+
+func newAuditEvent(event AuditEvent, userID int, update UserUpdate) AuditEvent {
+	event.UserID = userID
+	event.Fields = update.Fields()
+	event.CreatedAt = time.Now().UTC()
+	return event
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPatchUserChangesOnlyGivenFieldsAndAudits(t *testing.T) {
+	db := newTestDB(t)
+	user, err := db.CreateUser("a@b.com", "old-hash")
+	if err != nil {
+		t.Fatalf("couldn't create user: %v", err)
+	}
+
+	email := "c@d.com"
+	user, err = db.PatchUser(user.ID, UserUpdate{Email: &email}, AuditEvent{Action: AuditUserUpdated, IP: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("couldn't patch user: %v", err)
+	}
+	if user.Email != email || user.HashedPassword != "old-hash" {
+		t.Errorf("expected only the email to change, got %+v", user)
+	}
+
+	hash := "new-hash"
+	_, err = db.PatchUser(user.ID, UserUpdate{HashedPassword: &hash}, AuditEvent{Action: AuditPasswordReset})
+	if err != nil {
+		t.Fatalf("couldn't patch user: %v", err)
+	}
+
+	events, err := db.ListAuditEvents(user.ID)
+	if err != nil {
+		t.Fatalf("couldn't list audit events: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 audit events, got %d", len(events))
+	}
+	first, second := events[0], events[1]
+	if first.Action != AuditUserUpdated || len(first.Fields) != 1 || first.Fields[0] != "email" || first.IP != "127.0.0.1" {
+		t.Errorf("unexpected first event %+v", first)
+	}
+	if second.Action != AuditPasswordReset || len(second.Fields) != 1 || second.Fields[0] != "password" {
+		t.Errorf("unexpected second event %+v", second)
+	}
+
+	_, err = db.CreateUser("taken@b.com", "hash")
+	if err != nil {
+		t.Fatalf("couldn't create user: %v", err)
+	}
+	taken := "taken@b.com"
+	_, err = db.PatchUser(user.ID, UserUpdate{Email: &taken}, AuditEvent{Action: AuditUserUpdated})
+	if err != ErrAlreadyExists {
+		t.Errorf("expected a taken email to be refused, got %v", err)
+	}
+	events, _ = db.ListAuditEvents(user.ID)
+	if len(events) != 2 {
+		t.Errorf("expected a failed patch not to be audited, got %d events", len(events))
+	}
+}
+
+func TestPatchUserPasswordRevokesSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		user, _ := db.CreateUser("a@b.com", "old-hash")
+		expiresAt := time.Now().Add(time.Hour)
+		db.CreateRefreshToken("session", user.ID, expiresAt, Client{})
+
+		email := "c@d.com"
+		_, err := db.PatchUser(user.ID, UserUpdate{Email: &email}, AuditEvent{Action: AuditUserUpdated})
+		if err != nil {
+			t.Fatalf("couldn't patch user: %v", err)
+		}
+		if sessions, _ := db.ListSessions(user.ID); len(sessions) != 1 {
+			t.Fatalf("expected an email change to keep sessions, got %+v", sessions)
+		}
+
+		hash := "new-hash"
+		_, err = db.PatchUser(user.ID, UserUpdate{HashedPassword: &hash}, AuditEvent{Action: AuditUserUpdated})
+		if err != nil {
+			t.Fatalf("couldn't patch user: %v", err)
+		}
+		if sessions, _ := db.ListSessions(user.ID); len(sessions) != 0 {
+			t.Errorf("expected a password change to revoke sessions, got %+v", sessions)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"os"
+	"time"
+)
+
+// fileVersion identifies the database.json the cache was loaded from. A
+// different mtime or size means the file was changed outside this DB, for
+// example by hand or by a restore, and the cache must be reloaded.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFileVersion(path string) (fileVersion, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return fileVersion{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}, nil
+}
+
+// cacheFresh reports whether the cached state still matches the file on
+// disk. Callers must hold at least the read lock.
+func (db *DB) cacheFresh() bool {
+	if db.cache == nil {
+		return false
+	}
+	version, err := statFileVersion(db.path)
+	if err != nil {
+		return false
+	}
+	return version == db.cacheAt
+}
+
+// loadCache returns the cached state, reading database.json and replaying the
+// journal again if the file has changed since it was cached. Callers must hold the write lock.
+func (db *DB) loadCache() (*DBStructure, error) {
+	if db.cacheFresh() {
+		return db.cache, nil
+	}
+
+	version, err := statFileVersion(db.path)
+	if err != nil {
+		return nil, err
+	}
+	dbStructure, err := db.readDB()
+	if err != nil {
+		return nil, err
+	}
+	if db.journal != nil {
+		// The file only holds what was checkpointed; the rest is in the
+		// journal.
+		dbStructure, err = db.journal.replay(dbStructure)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Build the indexes now so readers sharing the cache never have to.
+	dbStructure.index()
+
+	db.cache = &dbStructure
+	db.cacheAt = version
+	return db.cache, nil
+}
+
+// markCacheWritten records that the cached state was just written through to
+// disk. Callers must hold the write lock.
+func (db *DB) markCacheWritten() error {
+	version, err := statFileVersion(db.path)
+	if err != nil {
+		db.invalidateCache()
+		return err
+	}
+	db.cacheAt = version
+	return nil
+}
+
+func (db *DB) invalidateCache() {
+	db.cache = nil
+	db.cacheAt = fileVersion{}
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCachePicksUpExternalEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("couldn't create db: %v", err)
+	}
+	db.CreateChirp("cached", 1)
+	chirps, _ := db.GetChirps()
+	if len(chirps) != 1 {
+		t.Fatalf("expected 1 chirp, got %d", len(chirps))
+	}
+
+	edited := `{"chirps":{"7":{"id":7,"body":"edited by hand","author_id":2}},"users":{},"revocations":{},"sequences":{"chirps":7,"users":0},"schema_version":1}`
+	err = os.WriteFile(path, []byte(edited), 0600)
+	if err != nil {
+		t.Fatalf("couldn't edit file: %v", err)
+	}
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+
+	chirp, err := db.GetChirp(7)
+	if err != nil {
+		t.Fatalf("expected edited chirp to be visible: %v", err)
+	}
+	if chirp.Body != "edited by hand" {
+		t.Errorf("unexpected body %q", chirp.Body)
+	}
+	if _, err := db.GetChirp(1); err != ErrNotExist {
+		t.Errorf("expected cached chirp to be gone, got %v", err)
+	}
+	byAuthor, _ := db.GetChirpsByAuthor(2)
+	if len(byAuthor) != 1 {
+		t.Errorf("expected index to be rebuilt, got %v", byAuthor)
+	}
+}
+
+func TestFailedUpdateDoesNotLeakIntoCache(t *testing.T) {
+	db := newTestDB(t)
+	user, _ := db.CreateUser("user@example.com", "hash")
+	chirp, _ := db.CreateChirp("kept", user.ID)
+
+	err := db.Update(func(tx *DBStructure) error {
+		tx.putUser(User{ID: tx.nextUserID(), Email: "ghost@example.com"})
+		changed := tx.Users[user.ID]
+		changed.Email = "changed@example.com"
+		tx.putUser(changed)
+		tx.deleteChirp(chirp.ID)
+		tx.putChirp(Chirp{ID: tx.nextChirpID(), Body: "ghost", AuthorId: user.ID})
+		return ErrAccessDenied
+	})
+	if err != ErrAccessDenied {
+		t.Fatalf("expected ErrAccessDenied, got %v", err)
+	}
+
+	if _, err := db.GetUserByEmail("ghost@example.com"); err != ErrNotExist {
+		t.Errorf("expected rolled back user to be absent, got %v", err)
+	}
+	if got, err := db.GetUserByEmail("user@example.com"); err != nil || got != user {
+		t.Errorf("expected the user's email to be put back, got %+v %v", got, err)
+	}
+	byAuthor, _ := db.GetChirpsByAuthor(user.ID)
+	if len(byAuthor) != 1 || byAuthor[0] != chirp {
+		t.Errorf("expected only the kept chirp, got %v", byAuthor)
+	}
+	next, _ := db.CreateChirp("next", user.ID)
+	if next.ID != chirp.ID+1 {
+		t.Errorf("expected the sequence to be put back, got id %d", next.ID)
+	}
+}
+
+func TestFailedUpdateKeepsCache(t *testing.T) {
+	db := newTestDB(t)
+	user, _ := db.CreateUser("user@example.com", "hash")
+	cached := db.cache
+
+	_, err := db.ConsumeOneTimeToken("unknown", PurposePasswordReset)
+	if err != ErrNotExist {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+	_, err = db.CreateUser("user@example.com", "hash")
+	if err != ErrAlreadyExists {
+		t.Fatalf("expected ErrAlreadyExists, got %v", err)
+	}
+
+	if db.cache != cached {
+		t.Error("expected failed updates to keep the cache")
+	}
+	if got, err := db.GetUserByEmail("user@example.com"); err != nil || got.ID != user.ID {
+		t.Errorf("expected cached user %d, got %v %v", user.ID, got, err)
+	}
+}
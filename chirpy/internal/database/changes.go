@@ -0,0 +1,115 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// changes records what an Update has touched. The first write to each map
+// entry, and to the sequences, saves the old value, so a failed transaction
+// can be undone in place and a successful one journals only what changed.
+type changes struct {
+	touched map[string]struct{}
+	undo    []func()
+	ops     []func() (journalOp, error)
+}
+
+func (tx *DBStructure) begin() {
+	tx.changes = &changes{touched: map[string]struct{}{}}
+}
+
+// rollback puts back everything the transaction touched, newest first.
+func (tx *DBStructure) rollback() {
+	c := tx.changes
+	tx.changes = nil
+	for i := len(c.undo) - 1; i >= 0; i-- {
+		c.undo[i]()
+	}
+}
+
+// finish ends the transaction and returns a journal op for each entry it
+// touched, holding that entry's final value.
+func (tx *DBStructure) finish() ([]journalOp, error) {
+	c := tx.changes
+	tx.changes = nil
+	ops := make([]journalOp, 0, len(c.ops))
+	for _, op := range c.ops {
+		journalOp, err := op()
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, journalOp)
+	}
+	return ops, nil
+}
+
+// touch records m[key] before its first write in the current transaction.
+// restore is called with the saved value on rollback; it runs outside the
+// transaction, so it may use the put/delete helpers freely.
+func touch[K comparable, V any](tx *DBStructure, field string, m map[K]V, key K, restore func(old V, existed bool)) {
+	c := tx.changes
+	if c == nil {
+		return
+	}
+	k := fmt.Sprint(key)
+	if _, ok := c.touched[field+"/"+k]; ok {
+		return
+	}
+	c.touched[field+"/"+k] = struct{}{}
+
+	old, existed := m[key]
+	c.undo = append(c.undo, func() { restore(old, existed) })
+	c.ops = append(c.ops, func() (journalOp, error) {
+		value, ok := m[key]
+		if !ok {
+			return journalOp{Field: field, Key: &k, Delete: true}, nil
+		}
+		dat, err := json.Marshal(value)
+		return journalOp{Field: field, Key: &k, Value: dat}, err
+	})
+}
+
+// setEntry and deleteEntry write maps that have no index. Users and chirps
+// go through putUser, putChirp and friends instead.
+func setEntry[K comparable, V any](tx *DBStructure, field string, m map[K]V, key K, value V) {
+	touch(tx, field, m, key, restoreEntry(m, key))
+	m[key] = value
+}
+
+func deleteEntry[K comparable, V any](tx *DBStructure, field string, m map[K]V, key K) {
+	if _, ok := m[key]; !ok {
+		return
+	}
+	touch(tx, field, m, key, restoreEntry(m, key))
+	delete(m, key)
+}
+
+func restoreEntry[K comparable, V any](m map[K]V, key K) func(V, bool) {
+	return func(old V, existed bool) {
+		if existed {
+			m[key] = old
+		} else {
+			delete(m, key)
+		}
+	}
+}
+
+// touchSequences records the sequences before the current transaction first
+// hands out or bumps an ID.
+func (tx *DBStructure) touchSequences() {
+	c := tx.changes
+	if c == nil {
+		return
+	}
+	if _, ok := c.touched["sequences"]; ok {
+		return
+	}
+	c.touched["sequences"] = struct{}{}
+
+	old := tx.Sequences
+	c.undo = append(c.undo, func() { tx.Sequences = old })
+	c.ops = append(c.ops, func() (journalOp, error) {
+		dat, err := json.Marshal(tx.Sequences)
+		return journalOp{Field: "sequences", Value: dat}, err
+	})
+}
@@ -1,7 +1,5 @@
 package database
 
-import "errors"
-
 type Chirp struct {
 	ID       int    `json:"id"`
 	Body     string `json:"body"`
@@ -9,20 +7,17 @@ type Chirp struct {
 }
 
 func (db *DB) CreateChirp(body string, authorId int) (Chirp, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return Chirp{}, err
-	}
-
-	id := len(dbStructure.Chirps) + 1
-	chirp := Chirp{
-		ID:       id,
-		Body:     body,
-		AuthorId: authorId,
-	}
-	dbStructure.Chirps[id] = chirp
-
-	err = db.writeDB(dbStructure)
+	chirp := Chirp{}
+	err := db.Update(func(tx *DBStructure) error {
+		id := tx.nextChirpID()
+		chirp = Chirp{
+			ID:       id,
+			Body:     body,
+			AuthorId: authorId,
+		}
+		tx.putChirp(chirp)
+		return nil
+	})
 	if err != nil {
 		return Chirp{}, err
 	}
@@ -31,55 +26,63 @@ func (db *DB) CreateChirp(body string, authorId int) (Chirp, error) {
 }
 
 func (db *DB) GetChirps() ([]Chirp, error) {
-	dbStructure, err := db.loadDB()
+	chirps := []Chirp{}
+	err := db.View(func(tx *DBStructure) error {
+		chirps = make([]Chirp, 0, len(tx.Chirps))
+		for _, chirp := range tx.Chirps {
+			chirps = append(chirps, chirp)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	chirps := make([]Chirp, 0, len(dbStructure.Chirps))
-	for _, chirp := range dbStructure.Chirps {
-		chirps = append(chirps, chirp)
+	return chirps, nil
+}
+
+func (db *DB) GetChirpsByAuthor(authorId int) ([]Chirp, error) {
+	chirps := []Chirp{}
+	err := db.View(func(tx *DBStructure) error {
+		chirps = findChirpsByAuthor(tx, authorId)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return chirps, nil
 }
 
 func (db *DB) GetChirp(id int) (Chirp, error) {
-	dbStructure, err := db.loadDB()
+	chirp := Chirp{}
+	err := db.View(func(tx *DBStructure) error {
+		var ok bool
+		chirp, ok = tx.Chirps[id]
+		if !ok {
+			return ErrNotExist
+		}
+		return nil
+	})
 	if err != nil {
 		return Chirp{}, err
 	}
 
-	chirp, ok := dbStructure.Chirps[id]
-	if !ok {
-		return Chirp{}, ErrNotExist
-	}
-
 	return chirp, nil
-
 }
 
 func (db *DB) DeleteChirp(id, authorId int) error {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return err
-	}
-
-	chirp, ok := dbStructure.Chirps[id]
-	if !ok {
-		return ErrNotExist
-	}
-
-	if chirp.AuthorId != authorId {
-		return ErrAccessDenied
-	}
-
-	delete(dbStructure.Chirps, id)
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return errors.New("error deleting chirp")
-	}
-
-	return nil
-
+	return db.Update(func(tx *DBStructure) error {
+		chirp, ok := tx.Chirps[id]
+		if !ok {
+			return ErrNotExist
+		}
+
+		if chirp.AuthorId != authorId {
+			return ErrAccessDenied
+		}
+
+		tx.deleteChirp(id)
+		return nil
+	})
 }
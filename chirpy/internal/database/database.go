@@ -3,7 +3,9 @@ package database
 import (
 	"encoding/json"
 	"errors"
+	"log"
 	"os"
+	"path/filepath"
 	"sync"
 )
 
@@ -11,32 +13,89 @@ var ErrNotExist = errors.New("resource does not exist")
 var ErrAccessDenied = errors.New("Access Denied")
 
 type DB struct {
-	path string
-	mu   *sync.RWMutex
+	path    string
+	mu      *sync.RWMutex
+	journal *journal
+	cache   *DBStructure
+	cacheAt fileVersion
 }
 
 type DBStructure struct {
-	Chirps      map[int]Chirp         `json:"chirps"`
-	Users       map[int]User          `json:"users"`
-	Revocations map[string]Revocation `json:"revocations"`
+	Chirps         map[int]Chirp            `json:"chirps"`
+	Users          map[int]User             `json:"users"`
+	RefreshTokens  map[string]RefreshToken  `json:"refresh_tokens"`
+	OneTimeTokens  map[string]OneTimeToken  `json:"one_time_tokens"`
+	TOTP           map[int]TOTP             `json:"totp"`
+	LoginThrottles map[string]LoginThrottle `json:"login_throttles"`
+	AuditEvents    map[int]AuditEvent       `json:"audit_events"`
+	Sequences      Sequences                `json:"sequences"`
+	SchemaVersion  int                      `json:"schema_version"`
+	JournalSeq     uint64                   `json:"journal_seq,omitempty"`
+
+	idx     *indexes
+	changes *changes
+}
+
+type Option func(*DB)
+
+// WithJournal makes an append-only journal at path the durable write path,
+// so a write costs one small fsynced append instead of rewriting
+// database.json. Use JournalPath for the conventional location.
+func WithJournal(path string) Option {
+	return func(db *DB) {
+		db.journal = &journal{
+			path:            path,
+			checkpointEvery: defaultCheckpointEvery,
+		}
+	}
+}
+
+// JournalPath is where the journal for the database at dbPath is kept.
+func JournalPath(dbPath string) string {
+	return dbPath + ".journal"
 }
 
-func NewDB(path string) (*DB, error) {
+func NewDB(path string, opts ...Option) (*DB, error) {
 	db := &DB{
 		path: path,
 		mu:   &sync.RWMutex{},
 	}
+	for _, opt := range opts {
+		opt(db)
+	}
+	if db.journal != nil {
+		err := db.journal.open()
+		if err != nil {
+			return db, err
+		}
+	}
 	err := db.ensureDB()
+	if err != nil {
+		return db, err
+	}
+	err = db.checkpointJournal()
+	if err != nil {
+		return db, err
+	}
+	err = db.migrate()
 	return db, err
 }
 
 func (db *DB) createDB() error {
 	dbStructure := DBStructure{
-		Chirps:      map[int]Chirp{},
-		Users:       map[int]User{},
-		Revocations: map[string]Revocation{},
+		Chirps:         map[int]Chirp{},
+		Users:          map[int]User{},
+		RefreshTokens:  map[string]RefreshToken{},
+		OneTimeTokens:  map[string]OneTimeToken{},
+		TOTP:           map[int]TOTP{},
+		LoginThrottles: map[string]LoginThrottle{},
+		AuditEvents:    map[int]AuditEvent{},
+		SchemaVersion:  currentSchemaVersion(),
 	}
-	return db.writeDB(dbStructure)
+	if db.journal != nil {
+		dbStructure.JournalSeq = db.journal.seq
+	}
+	return db.writeSnapshot(&dbStructure)
 }
 
 func (db *DB) ensureDB() error {
@@ -48,17 +107,74 @@ func (db *DB) ensureDB() error {
 }
 
 func (db *DB) ResetDB() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.invalidateCache()
+	if db.journal != nil {
+		err := db.journal.reset()
+		if err != nil {
+			return err
+		}
+	}
 	err := os.Remove(db.path)
-	if errors.Is(err, os.ErrNotExist) {
-		return nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
 	}
-	return db.ensureDB()
+	return db.createDB()
 }
 
-func (db *DB) loadDB() (DBStructure, error) {
+// View runs fn against the current state under a shared lock. fn must not
+// modify tx.
+func (db *DB) View(fn func(tx *DBStructure) error) error {
 	db.mu.RLock()
-	defer db.mu.RUnlock()
+	if db.cacheFresh() {
+		defer db.mu.RUnlock()
+		return fn(db.cache)
+	}
+	db.mu.RUnlock()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
+	tx, err := db.loadCache()
+	if err != nil {
+		return err
+	}
+	return fn(tx)
+}
+
+// Update runs fn under an exclusive lock and persists what it changed if fn
+// returns nil, so the read, the mutation and the write form a single
+// transaction. fn changes the cached state in place; if it fails, everything
+// it touched is put back.
+func (db *DB) Update(fn func(tx *DBStructure) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tx, err := db.loadCache()
+	if err != nil {
+		return err
+	}
+
+	tx.begin()
+	err = fn(tx)
+	if err != nil {
+		tx.rollback()
+		return err
+	}
+	ops, err := tx.finish()
+	if err == nil && len(ops) > 0 {
+		err = db.commit(tx, ops)
+	}
+	if err != nil {
+		db.invalidateCache()
+		return err
+	}
+	return nil
+}
+
+func (db *DB) readDB() (DBStructure, error) {
 	dbStructure := DBStructure{}
 	dat, err := os.ReadFile(db.path)
 	if errors.Is(err, os.ErrNotExist) {
@@ -71,19 +187,115 @@ func (db *DB) loadDB() (DBStructure, error) {
 	return dbStructure, nil
 }
 
-func (db *DB) writeDB(dbStructure DBStructure) error {
+// commit makes ops durable. Without a journal that means rewriting
+// database.json; with one, ops are appended to the journal and the file is
+// only rewritten at a checkpoint. Callers must hold the write lock.
+func (db *DB) commit(dbStructure *DBStructure, ops []journalOp) error {
+	if db.journal == nil {
+		return db.writeSnapshot(dbStructure)
+	}
+
+	seq, err := db.journal.append(ops)
+	if err != nil {
+		return err
+	}
+	dbStructure.JournalSeq = seq
+	if db.journal.pending < db.journal.checkpointEvery {
+		return nil
+	}
+	err = db.checkpoint(dbStructure)
+	if err != nil {
+		// The entry is already durable, so the write stands; the next one
+		// tries the checkpoint again.
+		log.Printf("couldn't checkpoint journal: %v", err)
+	}
+	return nil
+}
+
+// checkpoint writes dbStructure, which must include every journal entry, to
+// database.json and empties the journal. Callers must hold the write lock.
+func (db *DB) checkpoint(dbStructure *DBStructure) error {
+	err := db.writeSnapshot(dbStructure)
+	if err != nil {
+		return err
+	}
+	return db.journal.checkpoint()
+}
+
+// checkpointJournal folds entries left in the journal by the last run into
+// database.json, so it doesn't grow across restarts.
+func (db *DB) checkpointJournal() error {
+	if db.journal == nil {
+		return nil
+	}
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
+	dbStructure, err := db.loadCache()
+	if err != nil {
+		return err
+	}
+	if db.journal.pending == 0 {
+		return nil
+	}
+	return db.checkpoint(dbStructure)
+}
+
+// writeSnapshot rewrites database.json with dbStructure. Callers must hold
+// the write lock.
+func (db *DB) writeSnapshot(dbStructure *DBStructure) error {
 	dat, err := json.Marshal(dbStructure)
 	if err != nil {
 		return err
 	}
+	err = writeFileAtomic(db.path, dat, 0600)
+	if err != nil {
+		return err
+	}
+	if dbStructure == db.cache {
+		return db.markCacheWritten()
+	}
+	return nil
+}
 
-	err = os.WriteFile(db.path, dat, 0600)
+// writeFileAtomic writes data to a temp file next to path, fsyncs it and
+// renames it into place, so a crash leaves either the old or the new file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
 	if err != nil {
 		return err
 	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
 
-	return nil
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmpPath, perm)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
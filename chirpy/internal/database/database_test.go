@@ -0,0 +1,282 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func newTestDB(t *testing.T, opts ...Option) *DB {
+	t.Helper()
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"), opts...)
+	if err != nil {
+		t.Fatalf("couldn't create db: %v", err)
+	}
+	return db
+}
+
+func TestConcurrentCreatesAreNotLost(t *testing.T) {
+	db := newTestDB(t)
+	const workers = 50
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := db.CreateUser(fmt.Sprintf("user%d@example.com", i), "hash")
+			if err != nil {
+				t.Errorf("couldn't create user: %v", err)
+			}
+			_, err = db.CreateChirp(fmt.Sprintf("chirp %d", i), i)
+			if err != nil {
+				t.Errorf("couldn't create chirp: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	chirps, err := db.GetChirps()
+	if err != nil {
+		t.Fatalf("couldn't get chirps: %v", err)
+	}
+	if len(chirps) != workers {
+		t.Errorf("expected %d chirps, got %d", workers, len(chirps))
+	}
+	for i := 0; i < workers; i++ {
+		_, err := db.GetUserByEmail(fmt.Sprintf("user%d@example.com", i))
+		if err != nil {
+			t.Errorf("user %d was lost: %v", i, err)
+		}
+	}
+}
+
+func TestUpdateRollsBackOnError(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.CreateUser("user@example.com", "hash")
+	if err != nil {
+		t.Fatalf("couldn't create user: %v", err)
+	}
+
+	_, err = db.CreateUser("user@example.com", "other")
+	if err != ErrAlreadyExists {
+		t.Errorf("expected ErrAlreadyExists, got %v", err)
+	}
+
+	user, err := db.GetUserByEmail("user@example.com")
+	if err != nil {
+		t.Fatalf("couldn't get user: %v", err)
+	}
+	if user.HashedPassword != "hash" {
+		t.Errorf("expected original user to be unchanged")
+	}
+}
+
+func newJournaledDB(t *testing.T) (db *DB, dbPath, journalPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	dbPath = filepath.Join(dir, "database.json")
+	journalPath = JournalPath(dbPath)
+	db, err := NewDB(dbPath, WithJournal(journalPath))
+	if err != nil {
+		t.Fatalf("couldn't create db: %v", err)
+	}
+	return db, dbPath, journalPath
+}
+
+func TestUpdateJournalsOnlyTouchedRecords(t *testing.T) {
+	db, _, _ := newJournaledDB(t)
+	db.CreateChirp("kept", 1)
+	second, _ := db.CreateChirp("deleted", 1)
+	err := db.DeleteChirp(second.ID, 1)
+	if err != nil {
+		t.Fatalf("couldn't delete chirp: %v", err)
+	}
+	_, err = db.CreateUser("user@example.com", "hash")
+	if err != nil {
+		t.Fatalf("couldn't create user: %v", err)
+	}
+	db.CreateUser("user@example.com", "hash")
+
+	entries, err := db.journal.readEntries()
+	if err != nil {
+		t.Fatalf("couldn't read journal: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected an entry per successful write, got %+v", entries)
+	}
+	want := [][]string{
+		{"sequences", "chirps/1"},
+		{"sequences", "chirps/2"},
+		{"chirps/2 deleted"},
+		{"sequences", "users/1"},
+	}
+	for i, entry := range entries {
+		got := []string{}
+		for _, op := range entry.Ops {
+			name := op.Field
+			if op.Key != nil {
+				name += "/" + *op.Key
+			}
+			if op.Delete {
+				name += " deleted"
+			}
+			got = append(got, name)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want[i]) {
+			t.Errorf("entry %d: expected ops %v, got %v", entry.Seq, want[i], got)
+		}
+	}
+}
+
+// writeCrashedJournal leaves database.json at journal_seq 1 with a journal
+// holding entry 1, which it already contains, entry 2, which it doesn't, and
+// a torn entry 3 from a crash mid-append.
+func writeCrashedJournal(t *testing.T) (dbPath, journalPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	dbPath = filepath.Join(dir, "database.json")
+	journalPath = filepath.Join(dir, "database.journal")
+
+	snapshot := fmt.Sprintf(`{"chirps":{},"users":{},"sequences":{"chirps":1},"schema_version":%d,"journal_seq":1}`, currentSchemaVersion())
+	err := os.WriteFile(dbPath, []byte(snapshot), 0600)
+	if err != nil {
+		t.Fatalf("couldn't write db: %v", err)
+	}
+	entries := `{"seq":1,"ops":[{"field":"chirps","key":"1","value":{"id":1,"body":"already applied","author_id":1}}]}
+{"seq":2,"ops":[{"field":"chirps","key":"2","value":{"id":2,"body":"replayed","author_id":1}},{"field":"sequences","value":{"chirps":2,"users":0,"audit_events":0}}]}
+{"seq":3,"ops":[{"field":"chirps","key":"3","val`
+	err = os.WriteFile(journalPath, []byte(entries), 0600)
+	if err != nil {
+		t.Fatalf("couldn't write journal: %v", err)
+	}
+	return dbPath, journalPath
+}
+
+func TestJournalReplaysEntriesNewerThanSnapshot(t *testing.T) {
+	dbPath, journalPath := writeCrashedJournal(t)
+
+	db, err := NewDB(dbPath, WithJournal(journalPath))
+	if err != nil {
+		t.Fatalf("couldn't open db: %v", err)
+	}
+
+	chirp, err := db.GetChirp(2)
+	if err != nil || chirp.Body != "replayed" {
+		t.Errorf("expected entry 2 to be replayed, got %+v %v", chirp, err)
+	}
+	if _, err := db.GetChirp(1); err != ErrNotExist {
+		t.Errorf("expected entry 1 to be skipped as already applied, got %v", err)
+	}
+	if _, err := db.GetChirp(3); err != ErrNotExist {
+		t.Errorf("expected the torn entry to be ignored, got %v", err)
+	}
+	next, err := db.CreateChirp("next", 1)
+	if err != nil || next.ID != 3 {
+		t.Errorf("expected the replayed sequence to hand out id 3, got %+v %v", next, err)
+	}
+}
+
+func TestJournalIsTheWritePath(t *testing.T) {
+	dbPath, journalPath := writeCrashedJournal(t)
+
+	db, err := NewDB(dbPath, WithJournal(journalPath))
+	if err != nil {
+		t.Fatalf("couldn't open db: %v", err)
+	}
+	assertJournalEntries(t, journalPath, 0)
+	assertJournalSeq(t, dbPath, 2)
+
+	_, err = db.CreateChirp("after replay", 1)
+	if err != nil {
+		t.Fatalf("couldn't create chirp: %v", err)
+	}
+	assertJournalEntries(t, journalPath, 1)
+	assertJournalSeq(t, dbPath, 2)
+
+	reopened, err := NewDB(dbPath, WithJournal(journalPath))
+	if err != nil {
+		t.Fatalf("couldn't reopen db: %v", err)
+	}
+	chirp, err := reopened.GetChirp(3)
+	if err != nil || chirp.Body != "after replay" {
+		t.Errorf("expected the journaled chirp after a restart, got %+v %v", chirp, err)
+	}
+}
+
+func TestJournalCheckpointsPeriodically(t *testing.T) {
+	db, dbPath, journalPath := newJournaledDB(t)
+	db.journal.checkpointEvery = 3
+
+	for i := 1; i <= 4; i++ {
+		_, err := db.CreateChirp(fmt.Sprintf("chirp %d", i), 1)
+		if err != nil {
+			t.Fatalf("couldn't create chirp: %v", err)
+		}
+	}
+	assertJournalEntries(t, journalPath, 1)
+	assertJournalSeq(t, dbPath, 3)
+
+	chirps, _ := db.GetChirps()
+	if len(chirps) != 4 {
+		t.Errorf("expected 4 chirps, got %d", len(chirps))
+	}
+}
+
+func TestResetDBClearsJournal(t *testing.T) {
+	db, dbPath, journalPath := newJournaledDB(t)
+	db.CreateChirp("before reset", 1)
+	pending := `{"seq":99,"ops":[{"field":"chirps","key":"2","value":{"id":2,"body":"pending","author_id":1}}]}` + "\n"
+	err := os.WriteFile(journalPath, []byte(pending), 0600)
+	if err != nil {
+		t.Fatalf("couldn't write journal: %v", err)
+	}
+
+	err = db.ResetDB()
+	if err != nil {
+		t.Fatalf("couldn't reset db: %v", err)
+	}
+	entries, err := db.journal.readEntries()
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected the journal to be cleared, got %+v %v", entries, err)
+	}
+
+	reopened, err := NewDB(dbPath, WithJournal(journalPath))
+	if err != nil {
+		t.Fatalf("couldn't reopen db: %v", err)
+	}
+	if chirps, _ := reopened.GetChirps(); len(chirps) != 0 {
+		t.Errorf("expected nothing to be replayed after reset, got %v", chirps)
+	}
+}
+
+func assertJournalEntries(t *testing.T, path string, want int) {
+	t.Helper()
+	j := &journal{path: path}
+	entries, err := j.readEntries()
+	if err != nil {
+		t.Fatalf("couldn't read journal: %v", err)
+	}
+	if len(entries) != want {
+		t.Errorf("expected %d journal entries, got %d", want, len(entries))
+	}
+}
+
+func assertJournalSeq(t *testing.T, path string, want uint64) {
+	t.Helper()
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("couldn't read db: %v", err)
+	}
+	dbStructure := DBStructure{}
+	err = json.Unmarshal(dat, &dbStructure)
+	if err != nil {
+		t.Fatalf("couldn't decode db: %v", err)
+	}
+	if dbStructure.JournalSeq != want {
+		t.Errorf("expected journal_seq %d, got %d", want, dbStructure.JournalSeq)
+	}
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/validation"
+)
+
+// storedEmail is a user's email as it was written, before normalization.
+type storedEmail struct {
+	userID int
+	email  string
+}
+
+// normalizeStoredEmails works out the normalized email for each user whose
+// stored one isn't already. When several users normalize to the same
+// address the oldest keeps it and the rest are moved under the reserved
+// .invalid TLD, where no mail can be delivered, and logged so an admin can
+// sort them out. Emails that don't parse are left alone.
+func normalizeStoredEmails(users []storedEmail) map[int]string {
+	sort.Slice(users, func(i, j int) bool { return users[i].userID < users[j].userID })
+
+	owners := map[string]int{}
+	changes := map[int]string{}
+	for _, user := range users {
+		email, err := validation.NormalizeEmail(user.email)
+		if err != nil {
+			email = user.email
+		}
+		if owner, ok := owners[email]; ok {
+			duplicate := fmt.Sprintf("%s.duplicate-%d.invalid", email, user.userID)
+			log.Printf("user %d email %q collides with user %d; moved to %q", user.userID, user.email, owner, duplicate)
+			email = duplicate
+		}
+		owners[email] = user.userID
+		if email != user.email {
+			changes[user.userID] = email
+		}
+	}
+	return changes
+}
+
+// normalizeUserEmails rewrites stored emails into the form lookups use.
+func normalizeUserEmails(doc map[string]any) error {
+	users, err := objectField(doc, "users")
+	if err != nil {
+		return err
+	}
+	emails := []storedEmail{}
+	for key, v := range users {
+		user, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("user %s is not an object", key)
+		}
+		id, err := strconv.Atoi(key)
+		if err != nil {
+			return fmt.Errorf("user key %q is not an id", key)
+		}
+		emails = append(emails, storedEmail{userID: id, email: stringValue(user["email"])})
+	}
+	for id, email := range normalizeStoredEmails(emails) {
+		users[strconv.Itoa(id)].(map[string]any)["email"] = email
+	}
+	return nil
+}
+
+// migrateSQLiteUserEmails is normalizeUserEmails for SQLite. Changed rows are
+// parked on a placeholder first so swapping two addresses can't trip the
+// unique index.
+func migrateSQLiteUserEmails(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, email FROM users`)
+	if err != nil {
+		return err
+	}
+	emails := []storedEmail{}
+	for rows.Next() {
+		user := storedEmail{}
+		err = rows.Scan(&user.userID, &user.email)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		emails = append(emails, user)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	changes := normalizeStoredEmails(emails)
+	for id := range changes {
+		_, err = tx.Exec(`UPDATE users SET email = ? WHERE id = ?`, fmt.Sprintf("#migrating-%d", id), id)
+		if err != nil {
+			return err
+		}
+	}
+	for id, email := range changes {
+		_, err = tx.Exec(`UPDATE users SET email = ? WHERE id = ?`, email, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package database
+
+// indexes are secondary lookups over a loaded DBStructure. They are not
+// persisted; they're built on first use and then kept up to date by the
+// put/delete helpers below, so every mutation of Users or Chirps must go
+// through those helpers.
+type indexes struct {
+	userByEmail    map[string]int
+	chirpsByAuthor map[int]map[int]struct{}
+}
+
+func (tx *DBStructure) index() *indexes {
+	if tx.idx != nil {
+		return tx.idx
+	}
+	idx := &indexes{
+		userByEmail:    make(map[string]int, len(tx.Users)),
+		chirpsByAuthor: map[int]map[int]struct{}{},
+	}
+	for id, user := range tx.Users {
+		idx.userByEmail[user.Email] = id
+	}
+	for id, chirp := range tx.Chirps {
+		idx.addChirp(chirp.AuthorId, id)
+	}
+	tx.idx = idx
+	return idx
+}
+
+func (idx *indexes) addChirp(authorId, id int) {
+	ids, ok := idx.chirpsByAuthor[authorId]
+	if !ok {
+		ids = map[int]struct{}{}
+		idx.chirpsByAuthor[authorId] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func (idx *indexes) removeChirp(authorId, id int) {
+	ids := idx.chirpsByAuthor[authorId]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(idx.chirpsByAuthor, authorId)
+	}
+}
+
+func (tx *DBStructure) putUser(user User) {
+	touch(tx, "users", tx.Users, user.ID, func(old User, existed bool) {
+		if existed {
+			tx.putUser(old)
+		} else {
+			tx.deleteUser(user.ID)
+		}
+	})
+	if tx.idx != nil {
+		if old, ok := tx.Users[user.ID]; ok {
+			delete(tx.idx.userByEmail, old.Email)
+		}
+		tx.idx.userByEmail[user.Email] = user.ID
+	}
+	tx.Users[user.ID] = user
+}
+
+func (tx *DBStructure) deleteUser(id int) {
+	user, ok := tx.Users[id]
+	if !ok {
+		return
+	}
+	touch(tx, "users", tx.Users, id, func(old User, existed bool) {
+		tx.putUser(old)
+	})
+	if tx.idx != nil {
+		delete(tx.idx.userByEmail, user.Email)
+	}
+	delete(tx.Users, id)
+}
+
+func (tx *DBStructure) putChirp(chirp Chirp) {
+	touch(tx, "chirps", tx.Chirps, chirp.ID, func(old Chirp, existed bool) {
+		if existed {
+			tx.putChirp(old)
+		} else {
+			tx.deleteChirp(chirp.ID)
+		}
+	})
+	if tx.idx != nil {
+		if old, ok := tx.Chirps[chirp.ID]; ok {
+			tx.idx.removeChirp(old.AuthorId, old.ID)
+		}
+		tx.idx.addChirp(chirp.AuthorId, chirp.ID)
+	}
+	tx.Chirps[chirp.ID] = chirp
+}
+
+func (tx *DBStructure) deleteChirp(id int) {
+	chirp, ok := tx.Chirps[id]
+	if !ok {
+		return
+	}
+	touch(tx, "chirps", tx.Chirps, id, func(old Chirp, existed bool) {
+		tx.putChirp(old)
+	})
+	if tx.idx != nil {
+		tx.idx.removeChirp(chirp.AuthorId, id)
+	}
+	delete(tx.Chirps, id)
+}
+
+func findUserByEmail(tx *DBStructure, email string) (User, bool) {
+	id, ok := tx.index().userByEmail[email]
+	if !ok {
+		return User{}, false
+	}
+	user, ok := tx.Users[id]
+	return user, ok
+}
+
+func findChirpsByAuthor(tx *DBStructure, authorId int) []Chirp {
+	ids := tx.index().chirpsByAuthor[authorId]
+	chirps := make([]Chirp, 0, len(ids))
+	for id := range ids {
+		chirps = append(chirps, tx.Chirps[id])
+	}
+	return chirps
+}
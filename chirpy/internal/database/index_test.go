@@ -0,0 +1,118 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexesFollowMutations(t *testing.T) {
+	db := newTestDB(t)
+
+	user, _ := db.CreateUser("old@example.com", "hash")
+	newEmail := "new@example.com"
+	_, err := db.PatchUser(user.ID, UserUpdate{Email: &newEmail}, AuditEvent{Action: AuditUserUpdated})
+	if err != nil {
+		t.Fatalf("couldn't update user: %v", err)
+	}
+	if _, err := db.GetUserByEmail("old@example.com"); err != ErrNotExist {
+		t.Errorf("expected old email to be unindexed, got %v", err)
+	}
+	if got, err := db.GetUserByEmail("new@example.com"); err != nil || got.ID != user.ID {
+		t.Errorf("expected new email to find user %d, got %v %v", user.ID, got, err)
+	}
+
+	first, _ := db.CreateChirp("first", user.ID)
+	db.CreateChirp("second", user.ID)
+	db.CreateChirp("other", user.ID+1)
+	db.DeleteChirp(first.ID, user.ID)
+
+	chirps, err := db.GetChirpsByAuthor(user.ID)
+	if err != nil {
+		t.Fatalf("couldn't get chirps: %v", err)
+	}
+	if len(chirps) != 1 || chirps[0].Body != "second" {
+		t.Errorf("expected only the second chirp, got %v", chirps)
+	}
+}
+
+const benchmarkRecords = 100_000
+
+// benchmarkDB returns a DB holding benchmarkRecords users and chirps, with
+// its cache already loaded so only lookups are timed.
+func benchmarkDB(b *testing.B) *DB {
+	b.Helper()
+	db, err := NewDB(filepath.Join(b.TempDir(), "database.json"))
+	if err != nil {
+		b.Fatalf("couldn't create db: %v", err)
+	}
+	err = db.Update(func(tx *DBStructure) error {
+		for i := 1; i <= benchmarkRecords; i++ {
+			tx.putUser(User{ID: i, Email: fmt.Sprintf("user%d@example.com", i)})
+			tx.putChirp(Chirp{ID: i, Body: "chirp", AuthorId: i % 1000})
+		}
+		tx.touchSequences()
+		tx.Sequences.Users = benchmarkRecords
+		tx.Sequences.Chirps = benchmarkRecords
+		return nil
+	})
+	if err != nil {
+		b.Fatalf("couldn't fill db: %v", err)
+	}
+	return db
+}
+
+// The scan sub-benchmarks time the linear search the indexes replaced, over
+// the same cached state, as a baseline for the index ones.
+func BenchmarkGetUserByEmail(b *testing.B) {
+	db := benchmarkDB(b)
+	email := fmt.Sprintf("user%d@example.com", benchmarkRecords/2)
+
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			db.View(func(tx *DBStructure) error {
+				for _, user := range tx.Users {
+					if user.Email == email {
+						break
+					}
+				}
+				return nil
+			})
+		}
+	})
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := db.GetUserByEmail(email)
+			if err != nil {
+				b.Fatalf("couldn't get user: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkGetChirpsByAuthor(b *testing.B) {
+	db := benchmarkDB(b)
+	const authorId = 500
+
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			db.View(func(tx *DBStructure) error {
+				chirps := []Chirp{}
+				for _, chirp := range tx.Chirps {
+					if chirp.AuthorId == authorId {
+						chirps = append(chirps, chirp)
+					}
+				}
+				return nil
+			})
+		}
+	})
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := db.GetChirpsByAuthor(authorId)
+			if err != nil {
+				b.Fatalf("couldn't get chirps: %v", err)
+			}
+		}
+	})
+}
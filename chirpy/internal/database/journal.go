@@ -0,0 +1,228 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// journal is the durable write path for database.json. Each Update appends
+// and fsyncs one entry holding the records it changed, and the whole file is
+// only rewritten at a checkpoint, every checkpointEvery entries. Loading the
+// file replays the entries newer than its journal_seq.
+type journal struct {
+	path            string
+	seq             uint64
+	pending         int
+	checkpointEvery int
+}
+
+const defaultCheckpointEvery = 1000
+
+type journalEntry struct {
+	Seq uint64      `json:"seq"`
+	Ops []journalOp `json:"ops"`
+}
+
+// journalOp sets or deletes one top-level field of DBStructure or, when Key
+// is present, one entry of a map field such as chirps or users.
+type journalOp struct {
+	Field  string          `json:"field"`
+	Key    *string         `json:"key,omitempty"`
+	Value  json.RawMessage `json:"value,omitempty"`
+	Delete bool            `json:"delete,omitempty"`
+}
+
+// open picks up the sequence number of the last entry already on disk.
+func (j *journal) open() error {
+	entries, err := j.readEntries()
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		j.seq = entries[len(entries)-1].Seq
+	}
+	return nil
+}
+
+func (j *journal) append(ops []journalOp) (uint64, error) {
+	entry := journalEntry{
+		Seq: j.seq + 1,
+		Ops: ops,
+	}
+	dat, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	dat = append(dat, '\n')
+
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = f.Write(dat)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		// Don't leave a torn line for later entries to be appended after;
+		// replay stops at the first one.
+		f.Truncate(info.Size())
+		return 0, err
+	}
+
+	j.seq = entry.Seq
+	j.pending++
+	return j.seq, nil
+}
+
+// checkpoint discards the journal once database.json has been rewritten
+// with everything in it.
+func (j *journal) checkpoint() error {
+	j.pending = 0
+	err := os.Truncate(j.path, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (j *journal) reset() error {
+	j.seq = 0
+	j.pending = 0
+	err := os.Remove(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// replay applies every entry newer than dbStructure.JournalSeq. A torn final
+// line from a crash mid-append was never acknowledged and is ignored. The
+// sequence never goes backwards, so entries appended after a restore of an
+// older file aren't mistaken for ones it already contains.
+func (j *journal) replay(dbStructure DBStructure) (DBStructure, error) {
+	entries, err := j.readEntries()
+	if err != nil {
+		return dbStructure, err
+	}
+
+	j.seq = max(j.seq, dbStructure.JournalSeq)
+	j.pending = 0
+	for _, entry := range entries {
+		if entry.Seq <= dbStructure.JournalSeq {
+			continue
+		}
+		dbStructure, err = applyOps(dbStructure, entry.Ops)
+		if err != nil {
+			return dbStructure, err
+		}
+		dbStructure.JournalSeq = entry.Seq
+		j.seq = max(j.seq, entry.Seq)
+		j.pending++
+	}
+	return dbStructure, nil
+}
+
+func (j *journal) readEntries() ([]journalEntry, error) {
+	f, err := os.Open(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []journalEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		entry := journalEntry{}
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func applyOps(dbStructure DBStructure, ops []journalOp) (DBStructure, error) {
+	fields, err := structureFields(dbStructure)
+	if err != nil {
+		return dbStructure, err
+	}
+
+	for _, op := range ops {
+		if op.Key == nil {
+			if op.Delete {
+				delete(fields, op.Field)
+			} else {
+				fields[op.Field] = op.Value
+			}
+			continue
+		}
+		obj, ok := rawObject(fields[op.Field])
+		if !ok {
+			obj = map[string]json.RawMessage{}
+		}
+		if op.Delete {
+			delete(obj, *op.Key)
+		} else {
+			obj[*op.Key] = op.Value
+		}
+		fields[op.Field], err = json.Marshal(obj)
+		if err != nil {
+			return dbStructure, err
+		}
+	}
+
+	dat, err := json.Marshal(fields)
+	if err != nil {
+		return dbStructure, err
+	}
+	replayed := DBStructure{}
+	err = json.Unmarshal(dat, &replayed)
+	return replayed, err
+}
+
+// structureFields splits a DBStructure into its top-level JSON fields, minus
+// the journal bookkeeping itself.
+func structureFields(dbStructure DBStructure) (map[string]json.RawMessage, error) {
+	dat, err := json.Marshal(dbStructure)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(dat, &fields)
+	if err != nil {
+		return nil, err
+	}
+	delete(fields, "journal_seq")
+	return fields, nil
+}
+
+func rawObject(raw json.RawMessage) (map[string]json.RawMessage, bool) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return map[string]json.RawMessage{}, true
+	}
+	if trimmed[0] != '{' {
+		return nil, false
+	}
+	obj := map[string]json.RawMessage{}
+	err := json.Unmarshal(trimmed, &obj)
+	if err != nil {
+		return nil, false
+	}
+	return obj, true
+}
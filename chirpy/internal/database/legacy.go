@@ -0,0 +1,179 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/validation"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// legacyDB is the file layout written by the old _chirpy database.Db: records
+// keyed by their stringified ID, chirps without an author and users with a
+// bcrypt hash under "password".
+type legacyDB struct {
+	Chirps map[string]json.RawMessage `json:"chirps"`
+	Users  map[string]json.RawMessage `json:"users"`
+}
+
+type legacyChirp struct {
+	Id   int    `json:"id"`
+	Body string `json:"body"`
+}
+
+type legacyUser struct {
+	Id       int    `json:"id"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type LegacyImportReport struct {
+	UsersImported  int
+	ChirpsImported int
+	Skipped        []LegacySkippedRecord
+}
+
+type LegacySkippedRecord struct {
+	Kind   string
+	Key    string
+	Reason string
+}
+
+// ImportLegacy copies the users and chirps from a legacy _chirpy database
+// file into db, keeping their IDs. Legacy chirps had no author, so they are
+// imported with author_id 0. Records that can't be converted, or that clash
+// with records already in db, are skipped and listed in the report.
+func (db *DB) ImportLegacy(legacyPath string) (LegacyImportReport, error) {
+	report := LegacyImportReport{}
+
+	dat, err := os.ReadFile(legacyPath)
+	if err != nil {
+		return report, err
+	}
+	legacy := legacyDB{}
+	err = json.Unmarshal(dat, &legacy)
+	if err != nil {
+		return report, fmt.Errorf("couldn't decode legacy database: %w", err)
+	}
+
+	skip := func(kind, key, reason string) {
+		report.Skipped = append(report.Skipped, LegacySkippedRecord{
+			Kind:   kind,
+			Key:    key,
+			Reason: reason,
+		})
+	}
+
+	err = db.Update(func(tx *DBStructure) error {
+		for _, key := range sortedKeys(legacy.Users) {
+			user := legacyUser{}
+			err := json.Unmarshal(legacy.Users[key], &user)
+			if err != nil {
+				skip("user", key, "malformed record: "+err.Error())
+				continue
+			}
+			if reason := checkLegacyID(key, user.Id); reason != "" {
+				skip("user", key, reason)
+				continue
+			}
+			if user.Email == "" {
+				skip("user", key, "missing email")
+				continue
+			}
+			email, err := validation.NormalizeEmail(user.Email)
+			if err != nil {
+				skip("user", key, "invalid email: "+err.Error())
+				continue
+			}
+			if _, err := bcrypt.Cost([]byte(user.Password)); err != nil {
+				skip("user", key, "password is not a bcrypt hash")
+				continue
+			}
+			if _, ok := tx.Users[user.Id]; ok {
+				skip("user", key, "id already in use")
+				continue
+			}
+			if _, ok := findUserByEmail(tx, email); ok {
+				skip("user", key, "email already in use")
+				continue
+			}
+
+			tx.putUser(User{
+				ID:             user.Id,
+				Email:          email,
+				HashedPassword: user.Password,
+				Role:           DefaultRole,
+			})
+			if user.Id > tx.Sequences.Users {
+				tx.touchSequences()
+				tx.Sequences.Users = user.Id
+			}
+			report.UsersImported++
+		}
+
+		for _, key := range sortedKeys(legacy.Chirps) {
+			chirp := legacyChirp{}
+			err := json.Unmarshal(legacy.Chirps[key], &chirp)
+			if err != nil {
+				skip("chirp", key, "malformed record: "+err.Error())
+				continue
+			}
+			if reason := checkLegacyID(key, chirp.Id); reason != "" {
+				skip("chirp", key, reason)
+				continue
+			}
+			if chirp.Body == "" {
+				skip("chirp", key, "empty body")
+				continue
+			}
+			if _, ok := tx.Chirps[chirp.Id]; ok {
+				skip("chirp", key, "id already in use")
+				continue
+			}
+
+			tx.putChirp(Chirp{
+				ID:   chirp.Id,
+				Body: chirp.Body,
+			})
+			if chirp.Id > tx.Sequences.Chirps {
+				tx.touchSequences()
+				tx.Sequences.Chirps = chirp.Id
+			}
+			report.ChirpsImported++
+		}
+		return nil
+	})
+	if err != nil {
+		return LegacyImportReport{}, err
+	}
+	return report, nil
+}
+
+func checkLegacyID(key string, id int) string {
+	if id <= 0 {
+		return "missing or invalid id"
+	}
+	if key != strconv.Itoa(id) {
+		return fmt.Sprintf("key does not match id %d", id)
+	}
+	return ""
+}
+
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		x, errX := strconv.Atoi(keys[i])
+		y, errY := strconv.Atoi(keys[j])
+		if errX != nil || errY != nil {
+			return keys[i] < keys[j]
+		}
+		return x < y
+	})
+	return keys
+}
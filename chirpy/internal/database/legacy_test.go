@@ -0,0 +1,141 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeLegacyDB(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "legacy.json")
+	err := os.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		t.Fatalf("couldn't write legacy db: %v", err)
+	}
+	return path
+}
+
+func TestImportLegacyKeepsIDsAndBumpsSequences(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("couldn't hash password: %v", err)
+	}
+	path := writeLegacyDB(t, `{
+		"users": {"7": {"id": 7, "email": "Bob@Example.com", "password": "`+string(hash)+`"}},
+		"chirps": {"12": {"id": 12, "body": "hello"}}
+	}`)
+
+	db := newTestDB(t)
+	report, err := db.ImportLegacy(path)
+	if err != nil {
+		t.Fatalf("couldn't import: %v", err)
+	}
+	if report.UsersImported != 1 || report.ChirpsImported != 1 || len(report.Skipped) != 0 {
+		t.Errorf("expected 1 user and 1 chirp imported, got %+v", report)
+	}
+
+	user, err := db.GetUserByEmail("Bob@example.com")
+	if err != nil {
+		t.Fatalf("expected imported email to be normalized: %v", err)
+	}
+	if user.ID != 7 || user.Role != DefaultRole || user.HashedPassword != string(hash) {
+		t.Errorf("expected user 7 with the legacy hash and default role, got %+v", user)
+	}
+	chirp, err := db.GetChirp(12)
+	if err != nil || chirp.Body != "hello" || chirp.AuthorId != 0 {
+		t.Errorf("expected chirp 12 with no author, got %+v %v", chirp, err)
+	}
+
+	next, err := db.CreateUser("next@example.com", "hash")
+	if err != nil {
+		t.Fatalf("couldn't create user: %v", err)
+	}
+	if next.ID != 8 {
+		t.Errorf("expected next user id 8, got %d", next.ID)
+	}
+	nextChirp, err := db.CreateChirp("next", next.ID)
+	if err != nil {
+		t.Fatalf("couldn't create chirp: %v", err)
+	}
+	if nextChirp.ID != 13 {
+		t.Errorf("expected next chirp id 13, got %d", nextChirp.ID)
+	}
+}
+
+func TestImportLegacySkipsBadAndClashingRecords(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("couldn't hash password: %v", err)
+	}
+	db := newTestDB(t)
+	existing, err := db.CreateUser("taken@example.com", "hash")
+	if err != nil {
+		t.Fatalf("couldn't create user: %v", err)
+	}
+	chirp, err := db.CreateChirp("existing", existing.ID)
+	if err != nil {
+		t.Fatalf("couldn't create chirp: %v", err)
+	}
+
+	bcryptHash := string(hash)
+	path := writeLegacyDB(t, `{
+		"users": {
+			"1": {"id": 1, "email": "clash@example.com", "password": "`+bcryptHash+`"},
+			"2": {"id": 3, "email": "wrongkey@example.com", "password": "`+bcryptHash+`"},
+			"4": {"id": 4, "password": "`+bcryptHash+`"},
+			"5": {"id": 5, "email": "plain@example.com", "password": "hunter2"},
+			"6": {"id": 6, "email": "taken@Example.COM", "password": "`+bcryptHash+`"},
+			"8": {"id": 8, "email": "not an email", "password": "`+bcryptHash+`"},
+			"9": "nonsense"
+		},
+		"chirps": {
+			"1": {"id": 1, "body": "clash"},
+			"2": {"id": 2, "body": ""},
+			"x": {"body": "no id"}
+		}
+	}`)
+
+	report, err := db.ImportLegacy(path)
+	if err != nil {
+		t.Fatalf("couldn't import: %v", err)
+	}
+	if report.UsersImported != 0 || report.ChirpsImported != 0 {
+		t.Errorf("expected nothing imported, got %+v", report)
+	}
+
+	want := map[string]string{
+		"user 1":  "id already in use",
+		"user 2":  "key does not match id 3",
+		"user 4":  "missing email",
+		"user 5":  "password is not a bcrypt hash",
+		"user 6":  "email already in use",
+		"chirp 1": "id already in use",
+		"chirp 2": "empty body",
+		"chirp x": "missing or invalid id",
+	}
+	got := map[string]string{}
+	for _, skipped := range report.Skipped {
+		got[skipped.Kind+" "+skipped.Key] = skipped.Reason
+	}
+	for record, reason := range want {
+		if got[record] != reason {
+			t.Errorf("expected %s skipped with %q, got %q", record, reason, got[record])
+		}
+	}
+	for _, record := range []string{"user 8", "user 9"} {
+		if got[record] == "" {
+			t.Errorf("expected %s to be skipped", record)
+		}
+	}
+	if len(report.Skipped) != len(want)+2 {
+		t.Errorf("expected %d skipped records, got %+v", len(want)+2, report.Skipped)
+	}
+
+	unchanged, err := db.GetChirp(chirp.ID)
+	if err != nil || unchanged.Body != "existing" {
+		t.Errorf("expected existing chirp to be kept, got %+v %v", unchanged, err)
+	}
+}
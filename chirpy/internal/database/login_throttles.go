@@ -0,0 +1,131 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrLoginThrottled = errors.New("login attempt throttled")
+
+// LoginThrottle counts recent failed logins for one key, such as an account
+// or a client IP. Failures older than ExpiresAt no longer count.
+type LoginThrottle struct {
+	Key           string    `json:"key"`
+	Failures      int       `json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// GetLoginThrottle returns the failures recorded for key. Keys with no
+// unexpired failures return ErrNotExist.
+func (db *DB) GetLoginThrottle(key string) (LoginThrottle, error) {
+	throttle := LoginThrottle{}
+	err := db.View(func(tx *DBStructure) error {
+		var ok bool
+		throttle, ok = tx.LoginThrottles[key]
+		if !ok || !throttle.ExpiresAt.After(time.Now().UTC()) {
+			return ErrNotExist
+		}
+		return nil
+	})
+	if err != nil {
+		return LoginThrottle{}, err
+	}
+	return throttle, nil
+}
+
+// ReserveLoginAttempt counts a login attempt for key as failed before it is
+// made, in the same transaction that checks it is allowed, so concurrent
+// attempts each see the ones before them. retryAt says when the next attempt
+// is allowed after a throttle's failures. If that is still after now, nothing
+// is counted and the current throttle is returned with ErrLoginThrottled. The
+// count is kept for window after this attempt; one that had already expired
+// starts over. Attempts that turn out not to fail are taken back with
+// ReleaseLoginAttempt.
+func (db *DB) ReserveLoginAttempt(key string, now time.Time, window time.Duration, retryAt func(LoginThrottle) time.Time) (LoginThrottle, error) {
+	now = now.UTC()
+	throttle := LoginThrottle{}
+	err := db.Update(func(tx *DBStructure) error {
+		throttle = liveLoginThrottle(tx.LoginThrottles[key], key, now)
+		if retryAt(throttle).After(now) {
+			return ErrLoginThrottled
+		}
+		throttle = nextLoginThrottle(throttle, now, window)
+		setEntry(tx, "login_throttles", tx.LoginThrottles, key, throttle)
+		return nil
+	})
+	if errors.Is(err, ErrLoginThrottled) {
+		return throttle, err
+	}
+	if err != nil {
+		return LoginThrottle{}, err
+	}
+	return throttle, nil
+}
+
+// ReleaseLoginAttempt takes back an attempt reserved for key that didn't
+// fail after all.
+func (db *DB) ReleaseLoginAttempt(key string) error {
+	return db.Update(func(tx *DBStructure) error {
+		throttle, ok := tx.LoginThrottles[key]
+		if !ok {
+			return nil
+		}
+		throttle = releasedLoginThrottle(throttle)
+		if throttle.Failures == 0 {
+			deleteEntry(tx, "login_throttles", tx.LoginThrottles, key)
+			return nil
+		}
+		setEntry(tx, "login_throttles", tx.LoginThrottles, key, throttle)
+		return nil
+	})
+}
+
+// ClearLoginFailures forgets the failures recorded for key, which lifts any
+// lockout based on them.
+func (db *DB) ClearLoginFailures(key string) error {
+	return db.Update(func(tx *DBStructure) error {
+		deleteEntry(tx, "login_throttles", tx.LoginThrottles, key)
+		return nil
+	})
+}
+
+// PurgeExpiredLoginThrottles drops counts that expired before now.
+func (db *DB) PurgeExpiredLoginThrottles(now time.Time) (int, error) {
+	purged := 0
+	err := db.Update(func(tx *DBStructure) error {
+		for key, throttle := range tx.LoginThrottles {
+			if throttle.ExpiresAt.Before(now) {
+				deleteEntry(tx, "login_throttles", tx.LoginThrottles, key)
+				purged++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// liveLoginThrottle is throttle, or a fresh one for key if it has expired.
+func liveLoginThrottle(throttle LoginThrottle, key string, now time.Time) LoginThrottle {
+	if !throttle.ExpiresAt.After(now) {
+		return LoginThrottle{Key: key}
+	}
+	return throttle
+}
+
+func nextLoginThrottle(throttle LoginThrottle, now time.Time, window time.Duration) LoginThrottle {
+	throttle.Failures++
+	throttle.LastFailureAt = now
+	throttle.ExpiresAt = now.Add(window)
+	return throttle
+}
+
+func releasedLoginThrottle(throttle LoginThrottle) LoginThrottle {
+	if throttle.Failures > 0 {
+		throttle.Failures--
+	}
+	return throttle
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+// lockAfter returns a retryAt that refuses attempts once there have been n
+// failures, until they expire.
+func lockAfter(n int) func(LoginThrottle) time.Time {
+	return func(throttle LoginThrottle) time.Time {
+		if throttle.Failures >= n {
+			return throttle.ExpiresAt
+		}
+		return time.Time{}
+	}
+}
+
+func TestLoginAttemptsExpireReleaseAndClear(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		now := time.Now().UTC()
+
+		for i := 0; i < 3; i++ {
+			_, err := db.ReserveLoginAttempt("user:1", now, time.Hour, lockAfter(3))
+			if err != nil {
+				t.Fatalf("couldn't reserve attempt: %v", err)
+			}
+		}
+		throttle, err := db.ReserveLoginAttempt("user:1", now, time.Hour, lockAfter(3))
+		if err != ErrLoginThrottled || throttle.Failures != 3 {
+			t.Fatalf("expected a 4th attempt to be throttled at 3 failures, got %+v (%v)", throttle, err)
+		}
+
+		err = db.ReleaseLoginAttempt("user:1")
+		if err != nil {
+			t.Fatalf("couldn't release attempt: %v", err)
+		}
+		throttle, err = db.GetLoginThrottle("user:1")
+		if err != nil || throttle.Failures != 2 {
+			t.Fatalf("expected 2 failures after a release, got %+v (%v)", throttle, err)
+		}
+
+		throttle, err = db.ReserveLoginAttempt("user:1", now.Add(2*time.Hour), time.Hour, lockAfter(3))
+		if err != nil {
+			t.Fatalf("couldn't reserve attempt: %v", err)
+		}
+		if throttle.Failures != 1 {
+			t.Errorf("expected an expired count to start over, got %d", throttle.Failures)
+		}
+
+		err = db.ClearLoginFailures("user:1")
+		if err != nil {
+			t.Fatalf("couldn't clear failures: %v", err)
+		}
+		_, err = db.GetLoginThrottle("user:1")
+		if err != ErrNotExist {
+			t.Errorf("expected cleared failures to be gone, got %v", err)
+		}
+	})
+}
+
+func TestConcurrentLoginAttemptsRespectTheLimit(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		const workers, limit = 20, 5
+		now := time.Now().UTC()
+
+		results := make(chan error, workers)
+		for i := 0; i < workers; i++ {
+			go func() {
+				_, err := db.ReserveLoginAttempt("user:1", now, time.Hour, lockAfter(limit))
+				results <- err
+			}()
+		}
+		reserved := 0
+		for i := 0; i < workers; i++ {
+			switch err := <-results; err {
+			case nil:
+				reserved++
+			case ErrLoginThrottled:
+			default:
+				t.Errorf("unexpected error reserving concurrently: %v", err)
+			}
+		}
+		if reserved != limit {
+			t.Errorf("expected %d attempts to get through, got %d", limit, reserved)
+		}
+	})
+}
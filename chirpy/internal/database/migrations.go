@@ -0,0 +1,224 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Migration upgrades the raw contents of database.json from Version-1 to
+// Version. Migrations work on the decoded JSON document rather than
+// DBStructure so they can still see fields the current structs have dropped.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(doc map[string]any) error
+}
+
+// migrations must stay ordered by Version with no gaps. Append new ones;
+// never edit one that has shipped.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "seed id sequences from existing records",
+		Up:          seedSequences,
+	},
+	{
+		Version:     2,
+		Description: "drop token revocations",
+		Up:          dropField("revocations"),
+	},
+	{
+		Version:     3,
+		Description: "add refresh token rotation families",
+		Up:          addObjectField("refresh_tokens"),
+	},
+	{
+		Version:     4,
+		Description: "give existing users the default role",
+		Up:          seedUserRoles,
+	},
+	{
+		Version:     5,
+		Description: "add one-time tokens",
+		Up:          addObjectField("one_time_tokens"),
+	},
+	{
+		Version:     6,
+		Description: "add totp enrollments",
+		Up:          addObjectField("totp"),
+	},
+	{
+		Version:     7,
+		Description: "add login throttles",
+		Up:          addObjectField("login_throttles"),
+	},
+	{
+		Version:     8,
+		Description: "normalize user emails",
+		Up:          normalizeUserEmails,
+	},
+	{
+		Version:     9,
+		Description: "add account audit events",
+		Up:          addObjectField("audit_events"),
+	},
+}
+
+func currentSchemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrate brings the file at path up to the current schema version and
+// returns the migrations that were applied. With dryRun set it runs them in
+// memory only and returns what would be applied. The original file is backed
+// up before it is rewritten.
+func Migrate(path string, dryRun bool) ([]Migration, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeDocument(dat)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := intValue(doc["schema_version"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema_version: %w", err)
+	}
+	if version > currentSchemaVersion() {
+		return nil, fmt.Errorf("database schema version %d is newer than supported version %d", version, currentSchemaVersion())
+	}
+
+	applied := []Migration{}
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		err = m.Up(doc)
+		if err != nil {
+			return applied, fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+		doc["schema_version"] = m.Version
+		applied = append(applied, m)
+	}
+	if len(applied) == 0 {
+		return applied, nil
+	}
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return applied, err
+	}
+	err = json.Unmarshal(migrated, &DBStructure{})
+	if err != nil {
+		return applied, fmt.Errorf("migrated database does not decode: %w", err)
+	}
+	if dryRun {
+		return applied, nil
+	}
+
+	backupPath := fmt.Sprintf("%s.v%d-%s.bak", path, version, time.Now().UTC().Format("20060102T150405Z"))
+	err = writeFileAtomic(backupPath, dat, 0600)
+	if err != nil {
+		return applied, fmt.Errorf("couldn't back up database before migrating: %w", err)
+	}
+	err = writeFileAtomic(path, migrated, 0600)
+	if err != nil {
+		return applied, err
+	}
+	return applied, nil
+}
+
+func (db *DB) migrate() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.invalidateCache()
+	_, err := Migrate(db.path, false)
+	return err
+}
+
+func decodeDocument(dat []byte) (map[string]any, error) {
+	doc := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(dat))
+	decoder.UseNumber()
+	err := decoder.Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// objectField returns the JSON object stored under name, creating it if it
+// is missing or null.
+func objectField(doc map[string]any, name string) (map[string]any, error) {
+	switch v := doc[name].(type) {
+	case map[string]any:
+		return v, nil
+	case nil:
+		obj := map[string]any{}
+		doc[name] = obj
+		return obj, nil
+	default:
+		return nil, fmt.Errorf("field %q is not an object", name)
+	}
+}
+
+// addObjectField returns a migration that adds an empty object field, for
+// new maps in DBStructure.
+func addObjectField(name string) func(doc map[string]any) error {
+	return func(doc map[string]any) error {
+		_, err := objectField(doc, name)
+		return err
+	}
+}
+
+// dropField returns a migration that removes a field DBStructure no longer
+// has.
+func dropField(name string) func(doc map[string]any) error {
+	return func(doc map[string]any) error {
+		delete(doc, name)
+		return nil
+	}
+}
+
+func intValue(v any) (int, error) {
+	switch n := v.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return n, nil
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err
+	default:
+		return 0, fmt.Errorf("unexpected value %v", v)
+	}
+}
+
+func stringValue(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func maxIntKey(obj map[string]any) (int, error) {
+	max := 0
+	for key := range obj {
+		id, err := strconv.Atoi(key)
+		if err != nil {
+			return 0, fmt.Errorf("invalid id %q", key)
+		}
+		if id > max {
+			max = id
+		}
+	}
+	return max, nil
+}
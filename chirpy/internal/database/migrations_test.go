@@ -0,0 +1,200 @@
+package database
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const unversionedDB = `{"chirps":{"4":{"id":4,"body":"hi","author_id":1}},"users":{},"revocations":{}}`
+
+func TestMigrateDryRunLeavesFileUntouched(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	err := os.WriteFile(path, []byte(unversionedDB), 0600)
+	if err != nil {
+		t.Fatalf("couldn't write db: %v", err)
+	}
+
+	pending, err := Migrate(path, true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if len(pending) != len(migrations) {
+		t.Errorf("expected %d pending migrations, got %d", len(migrations), len(pending))
+	}
+
+	dat, _ := os.ReadFile(path)
+	if !bytes.Equal(dat, []byte(unversionedDB)) {
+		t.Errorf("expected dry run to leave the file unchanged")
+	}
+	backups, _ := filepath.Glob(path + ".*.bak")
+	if len(backups) != 0 {
+		t.Errorf("expected no backups from a dry run, got %v", backups)
+	}
+}
+
+func TestMigrateBacksUpAndSetsVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	err := os.WriteFile(path, []byte(unversionedDB), 0600)
+	if err != nil {
+		t.Fatalf("couldn't write db: %v", err)
+	}
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("couldn't open db: %v", err)
+	}
+
+	backups, _ := filepath.Glob(path + ".v0-*.bak")
+	if len(backups) != 1 {
+		t.Fatalf("expected one backup, got %v", backups)
+	}
+	dat, _ := os.ReadFile(backups[0])
+	if !bytes.Equal(dat, []byte(unversionedDB)) {
+		t.Errorf("expected backup to hold the original file")
+	}
+
+	err = db.View(func(tx *DBStructure) error {
+		if tx.SchemaVersion != currentSchemaVersion() {
+			t.Errorf("expected schema version %d, got %d", currentSchemaVersion(), tx.SchemaVersion)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("couldn't read db: %v", err)
+	}
+
+	pending, err := Migrate(path, true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected no pending migrations, got %d", len(pending))
+	}
+}
+
+func TestMigrateGivesExistingUsersDefaultRole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	err := os.WriteFile(path, []byte(`{"schema_version":3,"users":{"1":{"id":1,"email":"a@b.com"}}}`), 0600)
+	if err != nil {
+		t.Fatalf("couldn't write db: %v", err)
+	}
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("couldn't open db: %v", err)
+	}
+	user, err := db.GetUser(1)
+	if err != nil {
+		t.Fatalf("couldn't get user: %v", err)
+	}
+	if user.Role != DefaultRole {
+		t.Errorf("expected role %q, got %q", DefaultRole, user.Role)
+	}
+}
+
+func TestMigrateNormalizesUserEmails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	users := `{"1":{"id":1,"email":"Bob@Example.COM","role":"user"},` +
+		`"2":{"id":2,"email":"Bob@example.com","role":"user"},` +
+		`"3":{"id":3,"email":"Alice@Example.com","role":"user"}}`
+	err := os.WriteFile(path, []byte(`{"schema_version":7,"users":`+users+`}`), 0600)
+	if err != nil {
+		t.Fatalf("couldn't write db: %v", err)
+	}
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("couldn't open db: %v", err)
+	}
+	checkNormalizedEmails(t, db)
+}
+
+func TestSQLiteMigrateNormalizesUserEmails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.db")
+	db, err := NewSQLiteDB(path)
+	if err != nil {
+		t.Fatalf("couldn't open db: %v", err)
+	}
+	// Rewind to just before the normalization, undoing the later migrations.
+	_, err = db.conn.Exec(`
+		DROP TABLE audit_events;
+		INSERT INTO users (id, email, hashed_password, role) VALUES
+			(1, 'Bob@Example.COM', '', 'user'),
+			(2, 'Bob@example.com', '', 'user'),
+			(3, 'Alice@Example.com', '', 'user');
+		PRAGMA user_version = 10;
+	`)
+	if err != nil {
+		t.Fatalf("couldn't seed db: %v", err)
+	}
+	db.Close()
+
+	db, err = NewSQLiteDB(path)
+	if err != nil {
+		t.Fatalf("couldn't reopen db: %v", err)
+	}
+	defer db.Close()
+	checkNormalizedEmails(t, db)
+}
+
+// checkNormalizedEmails expects the oldest of two colliding users to keep the
+// normalized address and the newer one to be moved out of the way.
+func checkNormalizedEmails(t *testing.T, db Store) {
+	t.Helper()
+	want := map[int]string{
+		1: "Bob@example.com",
+		2: "Bob@example.com.duplicate-2.invalid",
+		3: "Alice@example.com",
+	}
+	for id, email := range want {
+		user, err := db.GetUser(id)
+		if err != nil {
+			t.Fatalf("couldn't get user %d: %v", id, err)
+		}
+		if user.Email != email {
+			t.Errorf("expected user %d email %q, got %q", id, email, user.Email)
+		}
+	}
+	user, err := db.GetUserByEmail("Bob@example.com")
+	if err != nil || user.ID != 1 {
+		t.Errorf("expected Bob@example.com to find user 1, got %d: %v", user.ID, err)
+	}
+}
+
+func TestMigrateDropsRevocations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	legacy := `{"chirps":{},"users":{},"revocations":{"secret.refresh.token":{"token":"secret.refresh.token","revoked_at":"2024-05-01T00:00:00Z"}},"schema_version":1}`
+	err := os.WriteFile(path, []byte(legacy), 0600)
+	if err != nil {
+		t.Fatalf("couldn't write db: %v", err)
+	}
+	_, err = NewDB(path)
+	if err != nil {
+		t.Fatalf("couldn't open db: %v", err)
+	}
+
+	dat, _ := os.ReadFile(path)
+	if strings.Contains(string(dat), "revocations") {
+		t.Errorf("expected revocations to be dropped, got %s", dat)
+	}
+}
+
+func TestSQLiteMigrateDropsRevocations(t *testing.T) {
+	db, err := NewSQLiteDB(filepath.Join(t.TempDir(), "database.db"))
+	if err != nil {
+		t.Fatalf("couldn't open db: %v", err)
+	}
+	defer db.Close()
+
+	tables := 0
+	err = db.conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'revocations'`).Scan(&tables)
+	if err != nil {
+		t.Fatalf("couldn't query schema: %v", err)
+	}
+	if tables != 0 {
+		t.Errorf("expected the revocations table to be dropped")
+	}
+}
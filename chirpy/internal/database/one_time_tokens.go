@@ -0,0 +1,109 @@
+package database
+
+import "time"
+
+// Purposes a OneTimeToken can be issued for. A token only redeems for the
+// purpose it was issued for.
+const (
+	PurposePasswordReset = "password_reset"
+	PurposeVerifyEmail   = "verify_email"
+)
+
+// OneTimeToken is a hashed, single-use, expiring token sent to a user out of
+// band, such as in a password reset email.
+type OneTimeToken struct {
+	TokenHash string    `json:"token_hash"`
+	Purpose   string    `json:"purpose"`
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateOneTimeToken stores token for userID. Any tokens the user still holds
+// for the same purpose are discarded, so only the newest one works.
+func (db *DB) CreateOneTimeToken(token, purpose string, userID int, expiresAt time.Time) error {
+	return db.Update(func(tx *DBStructure) error {
+		deleteOneTimeTokens(tx, userID, purpose)
+		setEntry(tx, "one_time_tokens", tx.OneTimeTokens, hashToken(token), OneTimeToken{
+			TokenHash: hashToken(token),
+			Purpose:   purpose,
+			UserID:    userID,
+			CreatedAt: time.Now().UTC(),
+			ExpiresAt: expiresAt.UTC(),
+		})
+		return nil
+	})
+}
+
+// GetOneTimeToken looks token up for purpose without redeeming it, such as
+// to check a request before the token is spent. It fails like
+// ConsumeOneTimeToken.
+func (db *DB) GetOneTimeToken(token, purpose string) (OneTimeToken, error) {
+	oneTimeToken := OneTimeToken{}
+	err := db.View(func(tx *DBStructure) error {
+		var err error
+		oneTimeToken, err = findOneTimeToken(tx, token, purpose)
+		return err
+	})
+	if err != nil {
+		return OneTimeToken{}, err
+	}
+	return oneTimeToken, nil
+}
+
+// ConsumeOneTimeToken redeems token for purpose and deletes it. Unknown,
+// expired and already used tokens, and tokens issued for another purpose,
+// all return ErrNotExist.
+func (db *DB) ConsumeOneTimeToken(token, purpose string) (OneTimeToken, error) {
+	oneTimeToken := OneTimeToken{}
+	err := db.Update(func(tx *DBStructure) error {
+		var err error
+		oneTimeToken, err = findOneTimeToken(tx, token, purpose)
+		if err != nil {
+			return err
+		}
+		deleteEntry(tx, "one_time_tokens", tx.OneTimeTokens, oneTimeToken.TokenHash)
+		return nil
+	})
+	if err != nil {
+		return OneTimeToken{}, err
+	}
+	return oneTimeToken, nil
+}
+
+// PurgeExpiredOneTimeTokens drops tokens that expired before now.
+func (db *DB) PurgeExpiredOneTimeTokens(now time.Time) (int, error) {
+	purged := 0
+	err := db.Update(func(tx *DBStructure) error {
+		for tokenHash, oneTimeToken := range tx.OneTimeTokens {
+			if oneTimeToken.ExpiresAt.Before(now) {
+				deleteEntry(tx, "one_time_tokens", tx.OneTimeTokens, tokenHash)
+				purged++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+func deleteOneTimeTokens(tx *DBStructure, userID int, purpose string) {
+	for tokenHash, oneTimeToken := range tx.OneTimeTokens {
+		if oneTimeToken.UserID == userID && oneTimeToken.Purpose == purpose {
+			deleteEntry(tx, "one_time_tokens", tx.OneTimeTokens, tokenHash)
+		}
+	}
+}
+
+func findOneTimeToken(tx *DBStructure, token, purpose string) (OneTimeToken, error) {
+	oneTimeToken, ok := tx.OneTimeTokens[hashToken(token)]
+	if !ok || oneTimeToken.Purpose != purpose {
+		return OneTimeToken{}, ErrNotExist
+	}
+	if !oneTimeToken.ExpiresAt.After(time.Now().UTC()) {
+		return OneTimeToken{}, ErrNotExist
+	}
+	return oneTimeToken, nil
+}
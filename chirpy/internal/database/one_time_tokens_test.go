@@ -0,0 +1,102 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOneTimeTokensAreSingleUse(t *testing.T) {
+	db := newTestDB(t)
+	expiresAt := time.Now().Add(time.Hour)
+
+	err := db.CreateOneTimeToken("first", PurposePasswordReset, 1, expiresAt)
+	if err != nil {
+		t.Fatalf("couldn't create token: %v", err)
+	}
+	err = db.CreateOneTimeToken("second", PurposePasswordReset, 1, expiresAt)
+	if err != nil {
+		t.Fatalf("couldn't create token: %v", err)
+	}
+
+	_, err = db.ConsumeOneTimeToken("first", PurposePasswordReset)
+	if err != ErrNotExist {
+		t.Errorf("expected a newer token to replace the old one, got %v", err)
+	}
+	_, err = db.ConsumeOneTimeToken("second", "some_other_purpose")
+	if err != ErrNotExist {
+		t.Errorf("expected a token to only redeem for its purpose, got %v", err)
+	}
+	_, err = db.GetOneTimeToken("second", PurposePasswordReset)
+	if err != nil {
+		t.Errorf("expected looking a token up to leave it redeemable, got %v", err)
+	}
+	oneTimeToken, err := db.ConsumeOneTimeToken("second", PurposePasswordReset)
+	if err != nil {
+		t.Fatalf("couldn't consume token: %v", err)
+	}
+	if oneTimeToken.UserID != 1 {
+		t.Errorf("expected user 1, got %d", oneTimeToken.UserID)
+	}
+	_, err = db.ConsumeOneTimeToken("second", PurposePasswordReset)
+	if err != ErrNotExist {
+		t.Errorf("expected a used token to be rejected, got %v", err)
+	}
+}
+
+func TestExpiredOneTimeTokenIsRejected(t *testing.T) {
+	db := newTestDB(t)
+
+	err := db.CreateOneTimeToken("stale", PurposePasswordReset, 1, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("couldn't create token: %v", err)
+	}
+	_, err = db.ConsumeOneTimeToken("stale", PurposePasswordReset)
+	if err != ErrNotExist {
+		t.Errorf("expected an expired token to be rejected, got %v", err)
+	}
+	purged, err := db.PurgeExpiredOneTimeTokens(time.Now())
+	if err != nil {
+		t.Fatalf("couldn't purge tokens: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("expected 1 purged token, got %d", purged)
+	}
+}
+
+func TestChangingEmailResetsVerification(t *testing.T) {
+	db := newTestDB(t)
+	user, err := db.CreateUser("a@b.com", "hash")
+	if err != nil {
+		t.Fatalf("couldn't create user: %v", err)
+	}
+	err = db.SetEmailVerified(user.ID)
+	if err != nil {
+		t.Fatalf("couldn't verify email: %v", err)
+	}
+	err = db.CreateOneTimeToken("pending", PurposeVerifyEmail, user.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("couldn't create token: %v", err)
+	}
+
+	newHash := "new-hash"
+	user, err = db.PatchUser(user.ID, UserUpdate{HashedPassword: &newHash}, AuditEvent{Action: AuditUserUpdated})
+	if err != nil {
+		t.Fatalf("couldn't update user: %v", err)
+	}
+	if !user.EmailVerified {
+		t.Error("expected a password change to keep the email verified")
+	}
+
+	newEmail := "c@d.com"
+	user, err = db.PatchUser(user.ID, UserUpdate{Email: &newEmail}, AuditEvent{Action: AuditUserUpdated})
+	if err != nil {
+		t.Fatalf("couldn't update user: %v", err)
+	}
+	if user.EmailVerified {
+		t.Error("expected a new email to need verifying")
+	}
+	_, err = db.ConsumeOneTimeToken("pending", PurposeVerifyEmail)
+	if err != ErrNotExist {
+		t.Errorf("expected links sent to the old email to stop working, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+var ErrTokenReused = errors.New("rotated token was reused")
+
+// RefreshToken is a stored opaque refresh token, kept only as its hash. It
+// is one link in a rotation family: every refresh replaces the presented
+// token with a new one in the same family, and presenting a token that was
+// already rotated out means it leaked, so the whole family is revoked.
+type RefreshToken struct {
+	TokenHash  string    `json:"token_hash"`
+	FamilyID   string    `json:"family_id"`
+	UserID     int       `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	IssuedAt   time.Time `json:"issued_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	RotatedAt  time.Time `json:"rotated_at"`
+	RevokedAt  time.Time `json:"revoked_at"`
+}
+
+// Client describes the device a refresh token was issued to.
+type Client struct {
+	UserAgent string
+	IP        string
+}
+
+// hashToken is the form tokens are stored and looked up in, so the database
+// never holds a usable token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newFamilyID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateRefreshToken stores token as the first token of a new family.
+func (db *DB) CreateRefreshToken(token string, userID int, expiresAt time.Time, client Client) (RefreshToken, error) {
+	familyID, err := newFamilyID()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	refreshToken := RefreshToken{
+		TokenHash: hashToken(token),
+		FamilyID:  familyID,
+		UserID:    userID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		IssuedAt:  time.Now().UTC(),
+		ExpiresAt: expiresAt.UTC(),
+	}
+	err = db.Update(func(tx *DBStructure) error {
+		setEntry(tx, "refresh_tokens", tx.RefreshTokens, refreshToken.TokenHash, refreshToken)
+		return nil
+	})
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	return refreshToken, nil
+}
+
+// RotateRefreshToken marks oldToken as used and stores newToken in its
+// family. If oldToken was already rotated the family is revoked and
+// ErrTokenReused is returned. Expired tokens return ErrTokenRevoked.
+func (db *DB) RotateRefreshToken(oldToken, newToken string, expiresAt time.Time, client Client) (RefreshToken, error) {
+	rotated := RefreshToken{}
+	reused := false
+	err := db.Update(func(tx *DBStructure) error {
+		now := time.Now().UTC()
+		old, ok := tx.RefreshTokens[hashToken(oldToken)]
+		if !ok {
+			return ErrNotExist
+		}
+		if !old.RevokedAt.IsZero() {
+			return ErrTokenRevoked
+		}
+		if !old.RotatedAt.IsZero() {
+			revokeFamily(tx, old.FamilyID, now)
+			reused = true
+			return nil
+		}
+		if !old.ExpiresAt.After(now) {
+			return ErrTokenRevoked
+		}
+
+		old.RotatedAt = now
+		old.LastUsedAt = now
+		setEntry(tx, "refresh_tokens", tx.RefreshTokens, old.TokenHash, old)
+		rotated = RefreshToken{
+			TokenHash: hashToken(newToken),
+			FamilyID:  old.FamilyID,
+			UserID:    old.UserID,
+			UserAgent: client.UserAgent,
+			IP:        client.IP,
+			IssuedAt:  now,
+			ExpiresAt: expiresAt.UTC(),
+		}
+		setEntry(tx, "refresh_tokens", tx.RefreshTokens, rotated.TokenHash, rotated)
+		return nil
+	})
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if reused {
+		return RefreshToken{}, ErrTokenReused
+	}
+	return rotated, nil
+}
+
+// RevokeRefreshToken revokes the family token belongs to.
+func (db *DB) RevokeRefreshToken(token string) error {
+	return db.Update(func(tx *DBStructure) error {
+		refreshToken, ok := tx.RefreshTokens[hashToken(token)]
+		if !ok {
+			return ErrNotExist
+		}
+		revokeFamily(tx, refreshToken.FamilyID, time.Now().UTC())
+		return nil
+	})
+}
+
+// PurgeExpiredRefreshTokens drops refresh tokens that expired before now.
+func (db *DB) PurgeExpiredRefreshTokens(now time.Time) (int, error) {
+	purged := 0
+	err := db.Update(func(tx *DBStructure) error {
+		for tokenHash, refreshToken := range tx.RefreshTokens {
+			if refreshToken.ExpiresAt.Before(now) {
+				deleteEntry(tx, "refresh_tokens", tx.RefreshTokens, tokenHash)
+				purged++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+func revokeFamily(tx *DBStructure, familyID string, now time.Time) {
+	for tokenHash, refreshToken := range tx.RefreshTokens {
+		if refreshToken.FamilyID != familyID || !refreshToken.RevokedAt.IsZero() {
+			continue
+		}
+		refreshToken.RevokedAt = now
+		setEntry(tx, "refresh_tokens", tx.RefreshTokens, tokenHash, refreshToken)
+	}
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRotatedRefreshTokenReuseRevokesFamily(t *testing.T) {
+	db := newTestDB(t)
+	expiresAt := time.Now().Add(time.Hour)
+
+	_, err := db.CreateRefreshToken("first", 1, expiresAt, Client{UserAgent: "test"})
+	if err != nil {
+		t.Fatalf("couldn't create refresh token: %v", err)
+	}
+	_, err = db.RotateRefreshToken("first", "second", expiresAt, Client{UserAgent: "test"})
+	if err != nil {
+		t.Fatalf("couldn't rotate refresh token: %v", err)
+	}
+
+	_, err = db.RotateRefreshToken("first", "attacker", expiresAt, Client{UserAgent: "test"})
+	if err != ErrTokenReused {
+		t.Fatalf("expected ErrTokenReused, got %v", err)
+	}
+	_, err = db.RotateRefreshToken("second", "third", expiresAt, Client{UserAgent: "test"})
+	if err != ErrTokenRevoked {
+		t.Errorf("expected the rest of the family to be revoked, got %v", err)
+	}
+}
+
+func TestRotateRefreshTokenRecordsUse(t *testing.T) {
+	db := newTestDB(t)
+	expiresAt := time.Now().Add(time.Hour)
+
+	_, err := db.CreateRefreshToken("first", 7, expiresAt, Client{UserAgent: "curl/8.0"})
+	if err != nil {
+		t.Fatalf("couldn't create refresh token: %v", err)
+	}
+	rotated, err := db.RotateRefreshToken("first", "second", expiresAt, Client{UserAgent: "firefox"})
+	if err != nil {
+		t.Fatalf("couldn't rotate refresh token: %v", err)
+	}
+	if rotated.UserID != 7 || rotated.UserAgent != "firefox" {
+		t.Errorf("unexpected rotated token: %+v", rotated)
+	}
+
+	old := RefreshToken{}
+	err = db.View(func(tx *DBStructure) error {
+		old = tx.RefreshTokens[hashToken("first")]
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("couldn't read database: %v", err)
+	}
+	if old.LastUsedAt.IsZero() {
+		t.Errorf("expected the rotated-out token to record its last use")
+	}
+	if old.UserAgent != "curl/8.0" {
+		t.Errorf("expected user agent %q, got %q", "curl/8.0", old.UserAgent)
+	}
+}
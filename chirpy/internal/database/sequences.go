@@ -0,0 +1,54 @@
+package database
+
+// Sequences holds the last ID handed out for each entity. IDs come from these
+// counters rather than the map size so a deleted ID is never reused.
+type Sequences struct {
+	Chirps      int `json:"chirps"`
+	Users       int `json:"users"`
+	AuditEvents int `json:"audit_events"`
+}
+
+func (tx *DBStructure) nextChirpID() int {
+	tx.touchSequences()
+	tx.Sequences.Chirps++
+	return tx.Sequences.Chirps
+}
+
+func (tx *DBStructure) nextUserID() int {
+	tx.touchSequences()
+	tx.Sequences.Users++
+	return tx.Sequences.Users
+}
+
+func (tx *DBStructure) nextAuditEventID() int {
+	tx.touchSequences()
+	tx.Sequences.AuditEvents++
+	return tx.Sequences.AuditEvents
+}
+
+// seedSequences moves each counter past the highest existing ID, for files
+// written before sequences were persisted.
+func seedSequences(doc map[string]any) error {
+	sequences, err := objectField(doc, "sequences")
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"chirps", "users"} {
+		records, err := objectField(doc, name)
+		if err != nil {
+			return err
+		}
+		maxID, err := maxIntKey(records)
+		if err != nil {
+			return err
+		}
+		current, err := intValue(sequences[name])
+		if err != nil {
+			return err
+		}
+		if maxID > current {
+			sequences[name] = maxID
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChirpIDsAreNotReusedAfterDelete(t *testing.T) {
+	db := newTestDB(t)
+
+	first, _ := db.CreateChirp("first", 1)
+	second, _ := db.CreateChirp("second", 1)
+	err := db.DeleteChirp(first.ID, 1)
+	if err != nil {
+		t.Fatalf("couldn't delete chirp: %v", err)
+	}
+
+	third, err := db.CreateChirp("third", 1)
+	if err != nil {
+		t.Fatalf("couldn't create chirp: %v", err)
+	}
+	if third.ID == first.ID || third.ID == second.ID {
+		t.Errorf("expected a fresh ID, got %d", third.ID)
+	}
+
+	got, err := db.GetChirp(second.ID)
+	if err != nil {
+		t.Fatalf("couldn't get chirp: %v", err)
+	}
+	if got.Body != "second" {
+		t.Errorf("expected chirp %d to be unchanged, got %q", second.ID, got.Body)
+	}
+}
+
+func TestIDsAreNotReusedAfterReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("couldn't create db: %v", err)
+	}
+	last, _ := db.CreateChirp("first", 1)
+	db.DeleteChirp(last.ID, 1)
+
+	db, err = NewDB(path)
+	if err != nil {
+		t.Fatalf("couldn't reopen db: %v", err)
+	}
+	next, _ := db.CreateChirp("second", 1)
+	if next.ID <= last.ID {
+		t.Errorf("expected ID greater than %d, got %d", last.ID, next.ID)
+	}
+}
+
+func TestSequencesAreSeededFromExistingIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	legacy := map[string]any{
+		"chirps": map[string]Chirp{
+			"2": {ID: 2, Body: "two", AuthorId: 1},
+			"5": {ID: 5, Body: "five", AuthorId: 1},
+		},
+		"users": map[string]User{
+			"3": {ID: 3, Email: "user@example.com"},
+		},
+		"revocations": map[string]any{},
+	}
+	dat, _ := json.Marshal(legacy)
+	err := os.WriteFile(path, dat, 0600)
+	if err != nil {
+		t.Fatalf("couldn't write legacy file: %v", err)
+	}
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("couldn't open db: %v", err)
+	}
+
+	chirp, _ := db.CreateChirp("six", 1)
+	if chirp.ID != 6 {
+		t.Errorf("expected chirp ID 6, got %d", chirp.ID)
+	}
+	user, _ := db.CreateUser("other@example.com", "hash")
+	if user.ID != 4 {
+		t.Errorf("expected user ID 4, got %d", user.ID)
+	}
+}
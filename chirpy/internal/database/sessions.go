@@ -0,0 +1,102 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// Session is a login as the user sees it: one refresh token family. Its ID
+// is the family ID, and the device details are those of the family's
+// current token.
+type Session struct {
+	ID         string
+	UserID     int
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+}
+
+// sessionsFromTokens groups a user's refresh tokens by family and returns
+// the families whose current token is still usable, most recently used
+// first.
+func sessionsFromTokens(tokens []RefreshToken, now time.Time) []Session {
+	createdAt := map[string]time.Time{}
+	for _, token := range tokens {
+		first, ok := createdAt[token.FamilyID]
+		if !ok || token.IssuedAt.Before(first) {
+			createdAt[token.FamilyID] = token.IssuedAt
+		}
+	}
+
+	sessions := []Session{}
+	for _, token := range tokens {
+		if !token.RotatedAt.IsZero() || !token.RevokedAt.IsZero() || !token.ExpiresAt.After(now) {
+			continue
+		}
+		sessions = append(sessions, Session{
+			ID:         token.FamilyID,
+			UserID:     token.UserID,
+			UserAgent:  token.UserAgent,
+			IP:         token.IP,
+			CreatedAt:  createdAt[token.FamilyID],
+			LastUsedAt: token.IssuedAt,
+			ExpiresAt:  token.ExpiresAt,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions
+}
+
+// ListSessions returns the user's active sessions.
+func (db *DB) ListSessions(userID int) ([]Session, error) {
+	tokens := []RefreshToken{}
+	err := db.View(func(tx *DBStructure) error {
+		for _, refreshToken := range tx.RefreshTokens {
+			if refreshToken.UserID == userID {
+				tokens = append(tokens, refreshToken)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessionsFromTokens(tokens, time.Now().UTC()), nil
+}
+
+// RevokeSession revokes one of the user's sessions. It returns ErrNotExist
+// if the user has no active session with that ID.
+func (db *DB) RevokeSession(userID int, sessionID string) error {
+	return db.Update(func(tx *DBStructure) error {
+		for _, refreshToken := range tx.RefreshTokens {
+			if refreshToken.FamilyID == sessionID && refreshToken.UserID == userID && refreshToken.RevokedAt.IsZero() {
+				revokeFamily(tx, sessionID, time.Now().UTC())
+				return nil
+			}
+		}
+		return ErrNotExist
+	})
+}
+
+// RevokeUserSessions revokes every session the user has, logging them out
+// everywhere.
+func (db *DB) RevokeUserSessions(userID int) error {
+	return db.Update(func(tx *DBStructure) error {
+		revokeUserSessions(tx, userID, time.Now().UTC())
+		return nil
+	})
+}
+
+func revokeUserSessions(tx *DBStructure, userID int, now time.Time) {
+	for tokenHash, refreshToken := range tx.RefreshTokens {
+		if refreshToken.UserID != userID || !refreshToken.RevokedAt.IsZero() {
+			continue
+		}
+		refreshToken.RevokedAt = now
+		setEntry(tx, "refresh_tokens", tx.RefreshTokens, tokenHash, refreshToken)
+	}
+}
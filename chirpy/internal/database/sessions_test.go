@@ -0,0 +1,74 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionsFollowRotationAndRevocation(t *testing.T) {
+	db := newTestDB(t)
+	expiresAt := time.Now().Add(time.Hour)
+
+	laptop, err := db.CreateRefreshToken("laptop", 1, expiresAt, Client{UserAgent: "firefox", IP: "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("couldn't create refresh token: %v", err)
+	}
+	_, err = db.CreateRefreshToken("phone", 1, expiresAt, Client{UserAgent: "ios", IP: "10.0.0.2"})
+	if err != nil {
+		t.Fatalf("couldn't create refresh token: %v", err)
+	}
+	_, err = db.CreateRefreshToken("other", 2, expiresAt, Client{})
+	if err != nil {
+		t.Fatalf("couldn't create refresh token: %v", err)
+	}
+	_, err = db.RotateRefreshToken("laptop", "laptop-2", expiresAt, Client{UserAgent: "firefox", IP: "10.0.0.3"})
+	if err != nil {
+		t.Fatalf("couldn't rotate refresh token: %v", err)
+	}
+
+	sessions, err := db.ListSessions(1)
+	if err != nil {
+		t.Fatalf("couldn't list sessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	if sessions[0].ID != laptop.FamilyID || sessions[0].IP != "10.0.0.3" {
+		t.Errorf("expected the rotated laptop session first, got %+v", sessions[0])
+	}
+	if !sessions[0].CreatedAt.Equal(laptop.IssuedAt) {
+		t.Errorf("expected the session to start at login, got %v", sessions[0].CreatedAt)
+	}
+
+	err = db.RevokeSession(2, laptop.FamilyID)
+	if err != ErrNotExist {
+		t.Errorf("expected another user's session to be hidden, got %v", err)
+	}
+	err = db.RevokeSession(1, laptop.FamilyID)
+	if err != nil {
+		t.Fatalf("couldn't revoke session: %v", err)
+	}
+	_, err = db.RotateRefreshToken("laptop-2", "laptop-3", expiresAt, Client{})
+	if err != ErrTokenRevoked {
+		t.Errorf("expected the revoked session's token to be rejected, got %v", err)
+	}
+
+	err = db.RevokeUserSessions(1)
+	if err != nil {
+		t.Fatalf("couldn't revoke sessions: %v", err)
+	}
+	sessions, err = db.ListSessions(1)
+	if err != nil {
+		t.Fatalf("couldn't list sessions: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("expected no sessions after logging out everywhere, got %d", len(sessions))
+	}
+	sessions, err = db.ListSessions(2)
+	if err != nil {
+		t.Fatalf("couldn't list sessions: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Errorf("expected other users' sessions to survive, got %d", len(sessions))
+	}
+}
@@ -0,0 +1,247 @@
+package database
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const snapshotTimeFormat = "20060102T150405.000000000Z"
+
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// SnapshotPolicy says where snapshots go and which old ones are pruned. A
+// zero Keep or MaxAge disables that half of the retention policy.
+type SnapshotPolicy struct {
+	Dir    string
+	Keep   int
+	MaxAge time.Duration
+}
+
+type SnapshotInfo struct {
+	Path      string
+	CreatedAt time.Time
+}
+
+// Snapshot writes a consistent copy of the current state to w. It is taken
+// under the read lock, so no write can land halfway through, and from memory,
+// so it includes writes still only in the journal.
+func (db *DB) Snapshot(w io.Writer) error {
+	return db.View(func(tx *DBStructure) error {
+		return json.NewEncoder(w).Encode(tx)
+	})
+}
+
+// TakeSnapshot writes a gzipped, timestamped snapshot of store into
+// policy.Dir and then prunes old snapshots. name is the database file name
+// the snapshots are grouped under.
+func TakeSnapshot(store Store, name string, policy SnapshotPolicy) (SnapshotInfo, error) {
+	err := os.MkdirAll(policy.Dir, 0700)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	createdAt := time.Now().UTC()
+	path := filepath.Join(policy.Dir, fmt.Sprintf("%s-%s.gz", name, createdAt.Format(snapshotTimeFormat)))
+
+	tmp, err := os.CreateTemp(policy.Dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := gzip.NewWriter(tmp)
+	err = store.Snapshot(zw)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	err = zw.Close()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	err = tmp.Sync()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	_, err = PruneSnapshots(name, policy)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	return SnapshotInfo{Path: path, CreatedAt: createdAt}, nil
+}
+
+// ListSnapshots returns the snapshots of name in policy.Dir, newest first.
+func ListSnapshots(name string, policy SnapshotPolicy) ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(policy.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []SnapshotInfo{}
+	for _, entry := range entries {
+		stamp, ok := strings.CutPrefix(entry.Name(), name+"-")
+		if !ok {
+			continue
+		}
+		stamp, ok = strings.CutSuffix(stamp, ".gz")
+		if !ok {
+			continue
+		}
+		createdAt, err := time.Parse(snapshotTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, SnapshotInfo{
+			Path:      filepath.Join(policy.Dir, entry.Name()),
+			CreatedAt: createdAt,
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// PruneSnapshots deletes snapshots beyond the newest policy.Keep and those
+// older than policy.MaxAge. The newest snapshot is always kept.
+func PruneSnapshots(name string, policy SnapshotPolicy) ([]SnapshotInfo, error) {
+	snapshots, err := ListSnapshots(name, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := []SnapshotInfo{}
+	now := time.Now().UTC()
+	for i, snapshot := range snapshots {
+		if i == 0 {
+			continue
+		}
+		tooMany := policy.Keep > 0 && i >= policy.Keep
+		tooOld := policy.MaxAge > 0 && now.Sub(snapshot.CreatedAt) > policy.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		err = os.Remove(snapshot.Path)
+		if err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, snapshot)
+	}
+	return pruned, nil
+}
+
+// RestoreSnapshot validates the gzipped snapshot at snapshotPath for driver
+// and atomically swaps it in as the database at dbPath, discarding the JSON
+// store's journal. The JSON store picks up the new file on its next request;
+// the SQLite store must be restarted.
+func RestoreSnapshot(driver, snapshotPath, dbPath string) error {
+	f, err := os.Open(snapshotPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	defer zr.Close()
+
+	dir := filepath.Dir(dbPath)
+	tmp, err := os.CreateTemp(dir, filepath.Base(dbPath)+".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	_, err = io.Copy(tmp, zr)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	err = tmp.Sync()
+	if err != nil {
+		return err
+	}
+
+	switch driver {
+	case "", DriverJSON:
+		err = validateJSONSnapshot(tmp.Name())
+	case DriverSQLite:
+		err = validateSQLiteSnapshot(tmp.Name())
+	default:
+		err = fmt.Errorf("unknown database driver %q", driver)
+	}
+	if err != nil {
+		return err
+	}
+
+	if driver != DriverSQLite {
+		// The journal holds writes made on top of the file being replaced;
+		// replaying them onto the restored one would mix the two.
+		err = os.Remove(JournalPath(dbPath))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	err = os.Chmod(tmp.Name(), 0600)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), dbPath)
+	if err != nil {
+		return err
+	}
+	err = syncDir(dir)
+	if err != nil {
+		return err
+	}
+
+	if driver == DriverSQLite {
+		return nil
+	}
+	_, err = Migrate(dbPath, false)
+	return err
+}
+
+func validateJSONSnapshot(path string) error {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dbStructure := DBStructure{}
+	err = json.Unmarshal(dat, &dbStructure)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if dbStructure.SchemaVersion > currentSchemaVersion() {
+		return fmt.Errorf("%w: schema version %d is newer than supported version %d", ErrInvalidSnapshot, dbStructure.SchemaVersion, currentSchemaVersion())
+	}
+	for id, chirp := range dbStructure.Chirps {
+		if chirp.ID != id {
+			return fmt.Errorf("%w: chirp %d stored under key %d", ErrInvalidSnapshot, chirp.ID, id)
+		}
+	}
+	for id, user := range dbStructure.Users {
+		if user.ID != id {
+			return fmt.Errorf("%w: user %d stored under key %d", ErrInvalidSnapshot, user.ID, id)
+		}
+	}
+	return nil
+}
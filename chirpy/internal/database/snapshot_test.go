@@ -0,0 +1,164 @@
+package database
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTakeSnapshotRestoresIntoNewDB(t *testing.T) {
+	db := newTestDB(t)
+	db.CreateChirp("saved", 1)
+	policy := SnapshotPolicy{Dir: filepath.Join(t.TempDir(), "snapshots")}
+
+	snapshot, err := TakeSnapshot(db, "database.json", policy)
+	if err != nil {
+		t.Fatalf("couldn't take snapshot: %v", err)
+	}
+	snapshots, err := ListSnapshots("database.json", policy)
+	if err != nil || len(snapshots) != 1 || snapshots[0].Path != snapshot.Path {
+		t.Fatalf("expected the snapshot to be listed, got %v %v", snapshots, err)
+	}
+
+	restored := filepath.Join(t.TempDir(), "database.json")
+	err = RestoreSnapshot(DriverJSON, snapshot.Path, restored)
+	if err != nil {
+		t.Fatalf("couldn't restore snapshot: %v", err)
+	}
+	restoredDB, err := NewDB(restored)
+	if err != nil {
+		t.Fatalf("couldn't open restored db: %v", err)
+	}
+	chirp, err := restoredDB.GetChirp(1)
+	if err != nil || chirp.Body != "saved" {
+		t.Errorf("expected the snapshotted chirp, got %+v %v", chirp, err)
+	}
+}
+
+func TestRestoreSnapshotDiscardsJournal(t *testing.T) {
+	db, dbPath, journalPath := newJournaledDB(t)
+	db.CreateChirp("journaled", 1)
+	policy := SnapshotPolicy{Dir: filepath.Join(t.TempDir(), "snapshots")}
+
+	snapshot, err := TakeSnapshot(db, "database.json", policy)
+	if err != nil {
+		t.Fatalf("couldn't take snapshot: %v", err)
+	}
+	db.CreateChirp("after snapshot", 1)
+
+	err = RestoreSnapshot(DriverJSON, snapshot.Path, dbPath)
+	if err != nil {
+		t.Fatalf("couldn't restore snapshot: %v", err)
+	}
+	restored, err := NewDB(dbPath, WithJournal(journalPath))
+	if err != nil {
+		t.Fatalf("couldn't open restored db: %v", err)
+	}
+	chirps, _ := restored.GetChirps()
+	if len(chirps) != 1 || chirps[0].Body != "journaled" {
+		t.Fatalf("expected only the snapshotted chirp, got %v", chirps)
+	}
+	next, err := restored.CreateChirp("next", 1)
+	if err != nil || next.ID != 2 {
+		t.Errorf("expected id 2 after the restore, got %+v %v", next, err)
+	}
+}
+
+// writeSnapshots creates empty snapshots of database.json taken the given
+// ages ago and returns the directory they are in.
+func writeSnapshots(t *testing.T, ages ...time.Duration) string {
+	t.Helper()
+	dir := t.TempDir()
+	now := time.Now().UTC()
+	for _, age := range ages {
+		name := fmt.Sprintf("database.json-%s.gz", now.Add(-age).Format(snapshotTimeFormat))
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0600)
+		if err != nil {
+			t.Fatalf("couldn't write snapshot: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy SnapshotPolicy
+		left   int
+	}{
+		{name: "keep", policy: SnapshotPolicy{Keep: 2}, left: 2},
+		{name: "max age", policy: SnapshotPolicy{MaxAge: 150 * time.Minute}, left: 2},
+		{name: "both", policy: SnapshotPolicy{Keep: 3, MaxAge: 90 * time.Minute}, left: 1},
+		{name: "newest always kept", policy: SnapshotPolicy{MaxAge: time.Minute}, left: 1},
+		{name: "no policy", policy: SnapshotPolicy{}, left: 4},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.policy.Dir = writeSnapshots(t, time.Hour, 2*time.Hour, 3*time.Hour, 4*time.Hour)
+
+			pruned, err := PruneSnapshots("database.json", c.policy)
+			if err != nil {
+				t.Fatalf("couldn't prune: %v", err)
+			}
+			left, _ := ListSnapshots("database.json", c.policy)
+			if len(left) != c.left || len(pruned) != 4-c.left {
+				t.Fatalf("expected %d snapshots left, got %d left and %d pruned", c.left, len(left), len(pruned))
+			}
+			for _, snapshot := range pruned {
+				if !snapshot.CreatedAt.Before(left[len(left)-1].CreatedAt) {
+					t.Errorf("expected only snapshots older than those kept to be pruned, got %v", snapshot.CreatedAt)
+				}
+			}
+		})
+	}
+}
+
+func TestRestoreSnapshotRejectsInvalidSnapshots(t *testing.T) {
+	gzipped := func(contents string) []byte {
+		buf := bytes.Buffer{}
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(contents))
+		zw.Close()
+		return buf.Bytes()
+	}
+	cases := []struct {
+		name     string
+		driver   string
+		snapshot []byte
+	}{
+		{name: "not gzip", driver: DriverJSON, snapshot: []byte(`{"chirps":{}}`)},
+		{name: "not json", driver: DriverJSON, snapshot: gzipped(`{"chirps":`)},
+		{name: "newer schema", driver: DriverJSON, snapshot: gzipped(`{"schema_version":1000}`)},
+		{name: "mismatched key", driver: DriverJSON, snapshot: gzipped(`{"users":{"1":{"id":2}}}`)},
+		{name: "not sqlite", driver: DriverSQLite, snapshot: gzipped(`{"chirps":{}}`)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			snapshotPath := filepath.Join(dir, "snapshot.gz")
+			err := os.WriteFile(snapshotPath, c.snapshot, 0600)
+			if err != nil {
+				t.Fatalf("couldn't write snapshot: %v", err)
+			}
+			dbPath := filepath.Join(dir, "database")
+			err = os.WriteFile(dbPath, []byte("original"), 0600)
+			if err != nil {
+				t.Fatalf("couldn't write db: %v", err)
+			}
+
+			err = RestoreSnapshot(c.driver, snapshotPath, dbPath)
+			if !errors.Is(err, ErrInvalidSnapshot) {
+				t.Errorf("expected ErrInvalidSnapshot, got %v", err)
+			}
+			dat, _ := os.ReadFile(dbPath)
+			if string(dat) != "original" {
+				t.Errorf("expected the database to be left alone, got %q", dat)
+			}
+		})
+	}
+}
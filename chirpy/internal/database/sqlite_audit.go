@@ -0,0 +1,39 @@
+package database
+
+import "strings"
+
+func (db *SQLiteDB) ListAuditEvents(userID int) ([]AuditEvent, error) {
+	rows, err := db.conn.Query(
+		`SELECT id, user_id, action, fields, ip, user_agent, created_at
+		FROM audit_events WHERE user_id = ? ORDER BY id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		event := AuditEvent{}
+		fields := ""
+		err = rows.Scan(&event.ID, &event.UserID, &event.Action, &fields, &event.IP, &event.UserAgent, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		event.Fields = []string{}
+		if fields != "" {
+			event.Fields = strings.Split(fields, ",")
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func insertAuditEvent(e sqlExecer, event AuditEvent) error {
+	_, err := e.Exec(
+		`INSERT INTO audit_events (user_id, action, fields, ip, user_agent, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		event.UserID, event.Action, strings.Join(event.Fields, ","), event.IP, event.UserAgent, event.CreatedAt,
+	)
+	return err
+}
@@ -0,0 +1,78 @@
+package database
+
+func (db *SQLiteDB) CreateChirp(body string, authorId int) (Chirp, error) {
+	res, err := db.conn.Exec(
+		`INSERT INTO chirps (body, author_id) VALUES (?, ?)`,
+		body, authorId,
+	)
+	if err != nil {
+		return Chirp{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Chirp{}, err
+	}
+	return Chirp{
+		ID:       int(id),
+		Body:     body,
+		AuthorId: authorId,
+	}, nil
+}
+
+func (db *SQLiteDB) GetChirps() ([]Chirp, error) {
+	return db.queryChirps(`SELECT id, body, author_id FROM chirps`)
+}
+
+func (db *SQLiteDB) GetChirpsByAuthor(authorId int) ([]Chirp, error) {
+	return db.queryChirps(`SELECT id, body, author_id FROM chirps WHERE author_id = ?`, authorId)
+}
+
+func (db *SQLiteDB) queryChirps(query string, args ...any) ([]Chirp, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chirps := []Chirp{}
+	for rows.Next() {
+		chirp := Chirp{}
+		err = rows.Scan(&chirp.ID, &chirp.Body, &chirp.AuthorId)
+		if err != nil {
+			return nil, err
+		}
+		chirps = append(chirps, chirp)
+	}
+	return chirps, rows.Err()
+}
+
+func (db *SQLiteDB) GetChirp(id int) (Chirp, error) {
+	chirp := Chirp{}
+	err := db.conn.QueryRow(
+		`SELECT id, body, author_id FROM chirps WHERE id = ?`,
+		id,
+	).Scan(&chirp.ID, &chirp.Body, &chirp.AuthorId)
+	if isNoRows(err) {
+		return Chirp{}, ErrNotExist
+	}
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, nil
+}
+
+func (db *SQLiteDB) DeleteChirp(id, authorId int) error {
+	chirp, err := db.GetChirp(id)
+	if err != nil {
+		return err
+	}
+	if chirp.AuthorId != authorId {
+		return ErrAccessDenied
+	}
+
+	_, err = db.conn.Exec(
+		`DELETE FROM chirps WHERE id = ? AND author_id = ?`,
+		id, authorId,
+	)
+	return err
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+func (db *SQLiteDB) GetLoginThrottle(key string) (LoginThrottle, error) {
+	throttle, err := getLoginThrottle(db.conn, key)
+	if err != nil {
+		return LoginThrottle{}, err
+	}
+	if !throttle.ExpiresAt.After(time.Now().UTC()) {
+		return LoginThrottle{}, ErrNotExist
+	}
+	return throttle, nil
+}
+
+func (db *SQLiteDB) ReserveLoginAttempt(key string, now time.Time, window time.Duration, retryAt func(LoginThrottle) time.Time) (LoginThrottle, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return LoginThrottle{}, err
+	}
+	defer tx.Rollback()
+
+	now = now.UTC()
+	throttle, err := getLoginThrottle(tx, key)
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return LoginThrottle{}, err
+	}
+	throttle = liveLoginThrottle(throttle, key, now)
+	if retryAt(throttle).After(now) {
+		return throttle, ErrLoginThrottled
+	}
+	throttle = nextLoginThrottle(throttle, now, window)
+	err = putLoginThrottle(tx, throttle)
+	if err != nil {
+		return LoginThrottle{}, err
+	}
+	return throttle, tx.Commit()
+}
+
+func (db *SQLiteDB) ReleaseLoginAttempt(key string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	throttle, err := getLoginThrottle(tx, key)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	throttle = releasedLoginThrottle(throttle)
+	if throttle.Failures == 0 {
+		_, err = tx.Exec(`DELETE FROM login_throttles WHERE key = ?`, key)
+	} else {
+		err = putLoginThrottle(tx, throttle)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *SQLiteDB) ClearLoginFailures(key string) error {
+	_, err := db.conn.Exec(`DELETE FROM login_throttles WHERE key = ?`, key)
+	return err
+}
+
+func (db *SQLiteDB) PurgeExpiredLoginThrottles(now time.Time) (int, error) {
+	res, err := db.conn.Exec(`DELETE FROM login_throttles WHERE expires_at < ?`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func getLoginThrottle(q sqlQueryer, key string) (LoginThrottle, error) {
+	throttle := LoginThrottle{}
+	err := q.QueryRow(
+		`SELECT key, failures, last_failure_at, expires_at FROM login_throttles WHERE key = ?`,
+		key,
+	).Scan(&throttle.Key, &throttle.Failures, &throttle.LastFailureAt, &throttle.ExpiresAt)
+	if isNoRows(err) {
+		return LoginThrottle{}, ErrNotExist
+	}
+	if err != nil {
+		return LoginThrottle{}, err
+	}
+	return throttle, nil
+}
+
+func putLoginThrottle(e sqlExecer, throttle LoginThrottle) error {
+	_, err := e.Exec(
+		`INSERT OR REPLACE INTO login_throttles (key, failures, last_failure_at, expires_at) VALUES (?, ?, ?, ?)`,
+		throttle.Key, throttle.Failures, throttle.LastFailureAt, throttle.ExpiresAt,
+	)
+	return err
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// sqliteMigration upgrades the SQLite schema from version-1 to version. The
+// applied version is tracked in PRAGMA user_version.
+type sqliteMigration struct {
+	version     int
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+var sqliteMigrations = []sqliteMigration{
+	{
+		version:     1,
+		description: "create users, chirps and revocations",
+		up:          execSQL(sqliteSchema),
+	},
+	{
+		version:     2,
+		description: "drop token revocations",
+		up:          execSQL(`DROP TABLE IF EXISTS revocations`),
+	},
+	{
+		version:     3,
+		description: "track refresh token rotation families",
+		up: execSQL(`
+			CREATE TABLE refresh_tokens (
+				token_hash TEXT     PRIMARY KEY,
+				family_id  TEXT     NOT NULL,
+				user_id    INTEGER  NOT NULL,
+				issued_at  DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL,
+				rotated_at DATETIME,
+				revoked_at DATETIME
+			);
+			CREATE INDEX refresh_tokens_family_id ON refresh_tokens (family_id);
+			CREATE INDEX refresh_tokens_expires_at ON refresh_tokens (expires_at);
+		`),
+	},
+	{
+		version:     4,
+		description: "record refresh token user agent and last use",
+		up: execSQL(`
+			ALTER TABLE refresh_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+			ALTER TABLE refresh_tokens ADD COLUMN last_used_at DATETIME;
+		`),
+	},
+	{
+		version:     5,
+		description: "record refresh token client ip and index sessions by user",
+		up: execSQL(`
+			ALTER TABLE refresh_tokens ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+			CREATE INDEX refresh_tokens_user_id ON refresh_tokens (user_id);
+		`),
+	},
+	{
+		version:     6,
+		description: "add user roles",
+		up:          execSQL(`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';`),
+	},
+	{
+		version:     7,
+		description: "add one-time tokens",
+		up: execSQL(`
+			CREATE TABLE one_time_tokens (
+				token_hash TEXT     PRIMARY KEY,
+				purpose    TEXT     NOT NULL,
+				user_id    INTEGER  NOT NULL,
+				created_at DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL
+			);
+			CREATE INDEX one_time_tokens_user_id ON one_time_tokens (user_id);
+			CREATE INDEX one_time_tokens_expires_at ON one_time_tokens (expires_at);
+		`),
+	},
+	{
+		version:     8,
+		description: "track email verification",
+		up:          execSQL(`ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT 0;`),
+	},
+	{
+		version:     9,
+		description: "add totp enrollments and recovery codes",
+		up: execSQL(`
+			CREATE TABLE totp (
+				user_id    INTEGER  PRIMARY KEY,
+				secret     TEXT     NOT NULL,
+				enabled    BOOLEAN  NOT NULL DEFAULT 0,
+				last_step  INTEGER  NOT NULL DEFAULT 0,
+				created_at DATETIME NOT NULL
+			);
+			CREATE TABLE totp_recovery_codes (
+				user_id   INTEGER NOT NULL,
+				code_hash TEXT    NOT NULL,
+				PRIMARY KEY (user_id, code_hash)
+			);
+		`),
+	},
+	{
+		version:     10,
+		description: "add login throttles",
+		up: execSQL(`
+			CREATE TABLE login_throttles (
+				key             TEXT     PRIMARY KEY,
+				failures        INTEGER  NOT NULL,
+				last_failure_at DATETIME NOT NULL,
+				expires_at      DATETIME NOT NULL
+			);
+			CREATE INDEX login_throttles_expires_at ON login_throttles (expires_at);
+		`),
+	},
+	{
+		version:     11,
+		description: "normalize user emails",
+		up:          migrateSQLiteUserEmails,
+	},
+	{
+		version:     12,
+		description: "add account audit events",
+		up: execSQL(`
+			CREATE TABLE audit_events (
+				id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+				user_id    INTEGER  NOT NULL,
+				action     TEXT     NOT NULL,
+				fields     TEXT     NOT NULL,
+				ip         TEXT     NOT NULL,
+				user_agent TEXT     NOT NULL,
+				created_at DATETIME NOT NULL
+			);
+			CREATE INDEX audit_events_user_id ON audit_events (user_id);
+		`),
+	},
+}
+
+func execSQL(query string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+func (db *SQLiteDB) migrate() error {
+	version := 0
+	err := db.conn.QueryRow(`PRAGMA user_version`).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range sqliteMigrations {
+		if m.version <= version {
+			continue
+		}
+		tx, err := db.conn.Begin()
+		if err != nil {
+			return err
+		}
+		err = m.up(tx)
+		if err == nil {
+			_, err = tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, m.version))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqlite migration %d (%s): %w", m.version, m.description, err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
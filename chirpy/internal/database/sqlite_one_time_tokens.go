@@ -0,0 +1,79 @@
+package database
+
+import "time"
+
+func (db *SQLiteDB) CreateOneTimeToken(token, purpose string, userID int, expiresAt time.Time) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM one_time_tokens WHERE user_id = ? AND purpose = ?`, userID, purpose)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO one_time_tokens (token_hash, purpose, user_id, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		hashToken(token), purpose, userID, time.Now().UTC(), expiresAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *SQLiteDB) GetOneTimeToken(token, purpose string) (OneTimeToken, error) {
+	return getOneTimeToken(db.conn, token, purpose)
+}
+
+func (db *SQLiteDB) ConsumeOneTimeToken(token, purpose string) (OneTimeToken, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return OneTimeToken{}, err
+	}
+	defer tx.Rollback()
+
+	oneTimeToken, err := getOneTimeToken(tx, token, purpose)
+	if err != nil {
+		return OneTimeToken{}, err
+	}
+	_, err = tx.Exec(`DELETE FROM one_time_tokens WHERE token_hash = ?`, oneTimeToken.TokenHash)
+	if err != nil {
+		return OneTimeToken{}, err
+	}
+	return oneTimeToken, tx.Commit()
+}
+
+func (db *SQLiteDB) PurgeExpiredOneTimeTokens(now time.Time) (int, error) {
+	res, err := db.conn.Exec(`DELETE FROM one_time_tokens WHERE expires_at < ?`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func getOneTimeToken(conn sqlQueryer, token, purpose string) (OneTimeToken, error) {
+	oneTimeToken := OneTimeToken{}
+	err := conn.QueryRow(
+		`SELECT token_hash, purpose, user_id, created_at, expires_at FROM one_time_tokens WHERE token_hash = ?`,
+		hashToken(token),
+	).Scan(
+		&oneTimeToken.TokenHash,
+		&oneTimeToken.Purpose,
+		&oneTimeToken.UserID,
+		&oneTimeToken.CreatedAt,
+		&oneTimeToken.ExpiresAt,
+	)
+	if isNoRows(err) {
+		return OneTimeToken{}, ErrNotExist
+	}
+	if err != nil {
+		return OneTimeToken{}, err
+	}
+	if oneTimeToken.Purpose != purpose || !oneTimeToken.ExpiresAt.After(time.Now().UTC()) {
+		return OneTimeToken{}, ErrNotExist
+	}
+	return oneTimeToken, nil
+}
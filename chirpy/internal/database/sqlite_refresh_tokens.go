@@ -0,0 +1,201 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+func (db *SQLiteDB) CreateRefreshToken(token string, userID int, expiresAt time.Time, client Client) (RefreshToken, error) {
+	familyID, err := newFamilyID()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	refreshToken := RefreshToken{
+		TokenHash: hashToken(token),
+		FamilyID:  familyID,
+		UserID:    userID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		IssuedAt:  time.Now().UTC(),
+		ExpiresAt: expiresAt.UTC(),
+	}
+	err = insertRefreshToken(db.conn, refreshToken)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	return refreshToken, nil
+}
+
+func (db *SQLiteDB) RotateRefreshToken(oldToken, newToken string, expiresAt time.Time, client Client) (RefreshToken, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	old, err := getRefreshToken(tx, hashToken(oldToken))
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if !old.RevokedAt.IsZero() {
+		return RefreshToken{}, ErrTokenRevoked
+	}
+	if !old.RotatedAt.IsZero() {
+		return RefreshToken{}, revokeReusedSQLiteFamily(tx, old.FamilyID, now)
+	}
+	if !old.ExpiresAt.After(now) {
+		return RefreshToken{}, ErrTokenRevoked
+	}
+
+	res, err := tx.Exec(
+		`UPDATE refresh_tokens SET rotated_at = ?, last_used_at = ? WHERE token_hash = ? AND rotated_at IS NULL`,
+		now, now, old.TokenHash,
+	)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if n == 0 {
+		// Another rotation of the same token got in first.
+		return RefreshToken{}, revokeReusedSQLiteFamily(tx, old.FamilyID, now)
+	}
+	rotated := RefreshToken{
+		TokenHash: hashToken(newToken),
+		FamilyID:  old.FamilyID,
+		UserID:    old.UserID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		IssuedAt:  now,
+		ExpiresAt: expiresAt.UTC(),
+	}
+	err = insertRefreshToken(tx, rotated)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	return rotated, tx.Commit()
+}
+
+func (db *SQLiteDB) RevokeRefreshToken(token string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	refreshToken, err := getRefreshToken(tx, hashToken(token))
+	if err != nil {
+		return err
+	}
+	err = revokeSQLiteFamily(tx, refreshToken.FamilyID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *SQLiteDB) PurgeExpiredRefreshTokens(now time.Time) (int, error) {
+	res, err := db.conn.Exec(`DELETE FROM refresh_tokens WHERE expires_at < ?`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// sqlExecer is satisfied by both *sql.DB and *sql.Tx.
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// sqlQueryer is satisfied by both *sql.DB and *sql.Tx.
+type sqlQueryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func insertRefreshToken(conn sqlExecer, refreshToken RefreshToken) error {
+	_, err := conn.Exec(
+		`INSERT INTO refresh_tokens (token_hash, family_id, user_id, user_agent, ip, issued_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		refreshToken.TokenHash,
+		refreshToken.FamilyID,
+		refreshToken.UserID,
+		refreshToken.UserAgent,
+		refreshToken.IP,
+		refreshToken.IssuedAt,
+		refreshToken.ExpiresAt,
+	)
+	return err
+}
+
+const refreshTokenColumns = `token_hash, family_id, user_id, user_agent, ip, issued_at, expires_at, last_used_at, rotated_at, revoked_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRefreshToken(row rowScanner) (RefreshToken, error) {
+	refreshToken := RefreshToken{}
+	lastUsedAt := sql.NullTime{}
+	rotatedAt := sql.NullTime{}
+	revokedAt := sql.NullTime{}
+	err := row.Scan(
+		&refreshToken.TokenHash,
+		&refreshToken.FamilyID,
+		&refreshToken.UserID,
+		&refreshToken.UserAgent,
+		&refreshToken.IP,
+		&refreshToken.IssuedAt,
+		&refreshToken.ExpiresAt,
+		&lastUsedAt,
+		&rotatedAt,
+		&revokedAt,
+	)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	refreshToken.LastUsedAt = lastUsedAt.Time
+	refreshToken.RotatedAt = rotatedAt.Time
+	refreshToken.RevokedAt = revokedAt.Time
+	return refreshToken, nil
+}
+
+func getRefreshToken(conn sqlQueryer, tokenHash string) (RefreshToken, error) {
+	refreshToken, err := scanRefreshToken(conn.QueryRow(
+		`SELECT `+refreshTokenColumns+` FROM refresh_tokens WHERE token_hash = ?`,
+		tokenHash,
+	))
+	if isNoRows(err) {
+		return RefreshToken{}, ErrNotExist
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	return refreshToken, nil
+}
+
+func revokeSQLiteFamily(tx *sql.Tx, familyID string, now time.Time) error {
+	_, err := tx.Exec(
+		`UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL`,
+		now, familyID,
+	)
+	return err
+}
+
+// revokeReusedSQLiteFamily commits the revocation of a family whose rotated
+// token was presented again and returns ErrTokenReused.
+func revokeReusedSQLiteFamily(tx *sql.Tx, familyID string, now time.Time) error {
+	err := revokeSQLiteFamily(tx, familyID, now)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return ErrTokenReused
+}
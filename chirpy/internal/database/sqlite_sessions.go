@@ -0,0 +1,58 @@
+package database
+
+import "time"
+
+func (db *SQLiteDB) ListSessions(userID int) ([]Session, error) {
+	rows, err := db.conn.Query(
+		`SELECT `+refreshTokenColumns+` FROM refresh_tokens WHERE user_id = ?`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []RefreshToken{}
+	for rows.Next() {
+		refreshToken, err := scanRefreshToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, refreshToken)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return sessionsFromTokens(tokens, time.Now().UTC()), nil
+}
+
+func (db *SQLiteDB) RevokeSession(userID int, sessionID string) error {
+	res, err := db.conn.Exec(
+		`UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND user_id = ? AND revoked_at IS NULL`,
+		time.Now().UTC(), sessionID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotExist
+	}
+	return nil
+}
+
+func (db *SQLiteDB) RevokeUserSessions(userID int) error {
+	return revokeSQLiteUserSessions(db.conn, userID, time.Now().UTC())
+}
+
+func revokeSQLiteUserSessions(conn sqlExecer, userID int, now time.Time) error {
+	_, err := conn.Exec(
+		`UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`,
+		now, userID,
+	)
+	return err
+}
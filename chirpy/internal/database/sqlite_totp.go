@@ -0,0 +1,156 @@
+package database
+
+import "time"
+
+func (db *SQLiteDB) StartTOTPEnrollment(userID int, secret string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	enabled := false
+	err = tx.QueryRow(`SELECT enabled FROM totp WHERE user_id = ?`, userID).Scan(&enabled)
+	if err != nil && !isNoRows(err) {
+		return err
+	}
+	if enabled {
+		return ErrTOTPEnabled
+	}
+	_, err = tx.Exec(`DELETE FROM totp_recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`INSERT OR REPLACE INTO totp (user_id, secret, enabled, last_step, created_at) VALUES (?, ?, 0, 0, ?)`,
+		userID, secret, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *SQLiteDB) GetTOTP(userID int) (TOTP, error) {
+	totp := TOTP{RecoveryCodeHashes: []string{}}
+	err := db.conn.QueryRow(
+		`SELECT user_id, secret, enabled, last_step, created_at FROM totp WHERE user_id = ?`,
+		userID,
+	).Scan(&totp.UserID, &totp.Secret, &totp.Enabled, &totp.LastStep, &totp.CreatedAt)
+	if isNoRows(err) {
+		return TOTP{}, ErrNotExist
+	}
+	if err != nil {
+		return TOTP{}, err
+	}
+
+	rows, err := db.conn.Query(`SELECT code_hash FROM totp_recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return TOTP{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		codeHash := ""
+		err = rows.Scan(&codeHash)
+		if err != nil {
+			return TOTP{}, err
+		}
+		totp.RecoveryCodeHashes = append(totp.RecoveryCodeHashes, codeHash)
+	}
+	return totp, rows.Err()
+}
+
+func (db *SQLiteDB) EnableTOTP(userID int, step int64, recoveryCodes []string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	enabled := false
+	err = tx.QueryRow(`SELECT enabled FROM totp WHERE user_id = ?`, userID).Scan(&enabled)
+	if isNoRows(err) {
+		return ErrNotExist
+	}
+	if err != nil {
+		return err
+	}
+	if enabled {
+		return ErrTOTPEnabled
+	}
+	_, err = tx.Exec(`UPDATE totp SET enabled = 1, last_step = ? WHERE user_id = ?`, step, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM totp_recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	for _, codeHash := range hashRecoveryCodes(recoveryCodes) {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO totp_recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *SQLiteDB) UseTOTPStep(userID int, step int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	lastStep := int64(0)
+	err = tx.QueryRow(`SELECT last_step FROM totp WHERE user_id = ? AND enabled = 1`, userID).Scan(&lastStep)
+	if isNoRows(err) {
+		return ErrNotExist
+	}
+	if err != nil {
+		return err
+	}
+	if step <= lastStep {
+		return ErrTOTPCodeReused
+	}
+	_, err = tx.Exec(`UPDATE totp SET last_step = ? WHERE user_id = ?`, step, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *SQLiteDB) ConsumeRecoveryCode(userID int, code string) error {
+	res, err := db.conn.Exec(
+		`DELETE FROM totp_recovery_codes
+		WHERE user_id = ? AND code_hash = ?
+		AND EXISTS (SELECT 1 FROM totp WHERE user_id = ? AND enabled = 1)`,
+		userID, hashToken(code), userID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(res)
+}
+
+func (db *SQLiteDB) DisableTOTP(userID int) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM totp_recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`DELETE FROM totp WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	err = expectOneRow(res)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
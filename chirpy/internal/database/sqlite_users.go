@@ -0,0 +1,198 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func (db *SQLiteDB) CreateUser(email, hashedPassword string) (User, error) {
+	res, err := db.conn.Exec(
+		`INSERT INTO users (email, hashed_password, role) VALUES (?, ?, ?)`,
+		email, hashedPassword, DefaultRole,
+	)
+	if isUniqueViolation(err) {
+		return User{}, ErrAlreadyExists
+	}
+	if err != nil {
+		return User{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return User{}, err
+	}
+	return User{
+		ID:             int(id),
+		Email:          email,
+		HashedPassword: hashedPassword,
+		IsChirpyRed:    false,
+		Role:           DefaultRole,
+	}, nil
+}
+
+const userColumns = `id, email, hashed_password, is_chirpy_red, role, email_verified`
+
+func (db *SQLiteDB) GetUser(id int) (User, error) {
+	return db.getUser(`SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+}
+
+func (db *SQLiteDB) GetUserByEmail(email string) (User, error) {
+	return db.getUser(`SELECT `+userColumns+` FROM users WHERE email = ?`, email)
+}
+
+func (db *SQLiteDB) ListUsers() ([]User, error) {
+	rows, err := db.conn.Query(`SELECT ` + userColumns + ` FROM users ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func scanUser(row rowScanner) (User, error) {
+	user := User{}
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.HashedPassword,
+		&user.IsChirpyRed,
+		&user.Role,
+		&user.EmailVerified,
+	)
+	return user, err
+}
+
+func (db *SQLiteDB) getUser(query string, args ...any) (User, error) {
+	user, err := scanUser(db.conn.QueryRow(query, args...))
+	if isNoRows(err) {
+		return User{}, ErrNotExist
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (db *SQLiteDB) PatchUser(id int, update UserUpdate, event AuditEvent) (User, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	user, err := updateSQLiteUser(tx, id, update)
+	if err != nil {
+		return User{}, err
+	}
+	if update.HashedPassword != nil {
+		err = revokeSQLiteUserSessions(tx, id, time.Now().UTC())
+		if err != nil {
+			return User{}, err
+		}
+	}
+	err = insertAuditEvent(tx, newAuditEvent(event, id, update))
+	if err != nil {
+		return User{}, err
+	}
+	return user, tx.Commit()
+}
+
+func updateSQLiteUser(tx *sql.Tx, id int, update UserUpdate) (User, error) {
+	user, err := scanUser(tx.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+	if isNoRows(err) {
+		return User{}, ErrNotExist
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	if update.Email != nil && *update.Email != user.Email {
+		// A new email address has to be verified again, and links sent to
+		// the old one must stop working.
+		_, err = tx.Exec(
+			`DELETE FROM one_time_tokens WHERE user_id = ? AND purpose = ?`,
+			id, PurposeVerifyEmail,
+		)
+		if err != nil {
+			return User{}, err
+		}
+		user.Email = *update.Email
+		user.EmailVerified = false
+	}
+	if update.HashedPassword != nil {
+		user.HashedPassword = *update.HashedPassword
+	}
+
+	_, err = tx.Exec(
+		`UPDATE users SET email = ?, hashed_password = ?, email_verified = ? WHERE id = ?`,
+		user.Email, user.HashedPassword, user.EmailVerified, id,
+	)
+	if isUniqueViolation(err) {
+		return User{}, ErrAlreadyExists
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (db *SQLiteDB) SetEmailVerified(id int) error {
+	res, err := db.conn.Exec(`UPDATE users SET email_verified = 1 WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(res)
+}
+
+func (db *SQLiteDB) UpdateUserRole(id int, role string) (User, error) {
+	res, err := db.conn.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, id)
+	if err != nil {
+		return User{}, err
+	}
+	err = expectOneRow(res)
+	if err != nil {
+		return User{}, err
+	}
+	return db.GetUser(id)
+}
+
+func (db *SQLiteDB) ReplacePasswordHash(id int, oldHash, newHash string) error {
+	res, err := db.conn.Exec(
+		`UPDATE users SET hashed_password = ? WHERE id = ? AND hashed_password = ?`,
+		newHash, id, oldHash,
+	)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(res)
+}
+
+func (db *SQLiteDB) UpdateChirpyRedSubscription(id int, isChirpyRed bool) error {
+	res, err := db.conn.Exec(
+		`UPDATE users SET is_chirpy_red = ? WHERE id = ?`,
+		isChirpyRed, id,
+	)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(res)
+}
+
+func isUniqueViolation(err error) bool {
+	sqliteErr := sqlite3.Error{}
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	DriverJSON   = "json"
+	DriverSQLite = "sqlite"
+)
+
+type Store interface {
+	CreateChirp(body string, authorId int) (Chirp, error)
+	GetChirps() ([]Chirp, error)
+	GetChirpsByAuthor(authorId int) ([]Chirp, error)
+	GetChirp(id int) (Chirp, error)
+	DeleteChirp(id, authorId int) error
+
+	CreateUser(email, hashedPassword string) (User, error)
+	GetUser(id int) (User, error)
+	GetUserByEmail(email string) (User, error)
+	PatchUser(id int, update UserUpdate, event AuditEvent) (User, error)
+	ListAuditEvents(userID int) ([]AuditEvent, error)
+	UpdateUserRole(id int, role string) (User, error)
+	ReplacePasswordHash(id int, oldHash, newHash string) error
+	SetEmailVerified(id int) error
+	ListUsers() ([]User, error)
+	UpdateChirpyRedSubscription(id int, isChirpyRed bool) error
+
+	CreateRefreshToken(token string, userID int, expiresAt time.Time, client Client) (RefreshToken, error)
+	RotateRefreshToken(oldToken, newToken string, expiresAt time.Time, client Client) (RefreshToken, error)
+	RevokeRefreshToken(token string) error
+	PurgeExpiredRefreshTokens(now time.Time) (int, error)
+
+	CreateOneTimeToken(token, purpose string, userID int, expiresAt time.Time) error
+	GetOneTimeToken(token, purpose string) (OneTimeToken, error)
+	ConsumeOneTimeToken(token, purpose string) (OneTimeToken, error)
+	PurgeExpiredOneTimeTokens(now time.Time) (int, error)
+
+	StartTOTPEnrollment(userID int, secret string) error
+	GetTOTP(userID int) (TOTP, error)
+	EnableTOTP(userID int, step int64, recoveryCodes []string) error
+	UseTOTPStep(userID int, step int64) error
+	ConsumeRecoveryCode(userID int, code string) error
+	DisableTOTP(userID int) error
+
+	GetLoginThrottle(key string) (LoginThrottle, error)
+	ReserveLoginAttempt(key string, now time.Time, window time.Duration, retryAt func(LoginThrottle) time.Time) (LoginThrottle, error)
+	ReleaseLoginAttempt(key string) error
+	ClearLoginFailures(key string) error
+	PurgeExpiredLoginThrottles(now time.Time) (int, error)
+
+	ListSessions(userID int) ([]Session, error)
+	RevokeSession(userID int, sessionID string) error
+	RevokeUserSessions(userID int) error
+
+	Snapshot(w io.Writer) error
+	ResetDB() error
+}
+
+var _ Store = (*DB)(nil)
+var _ Store = (*SQLiteDB)(nil)
+
+// Open returns the Store for driver backed by the file at path. Options only
+// apply to the JSON driver.
+func Open(driver, path string, opts ...Option) (Store, error) {
+	switch driver {
+	case "", DriverJSON:
+		db, err := NewDB(path, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	case DriverSQLite:
+		db, err := NewSQLiteDB(path)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
+}
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// forEachStore runs test against a fresh store for every driver, so both
+// backends are held to the same behaviour.
+func forEachStore(t *testing.T, test func(t *testing.T, db Store)) {
+	t.Run(DriverJSON, func(t *testing.T) {
+		test(t, newTestDB(t))
+	})
+	t.Run(DriverSQLite, func(t *testing.T) {
+		db, err := NewSQLiteDB(filepath.Join(t.TempDir(), "database.db"))
+		if err != nil {
+			t.Fatalf("couldn't create db: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		test(t, db)
+	})
+}
+
+func TestStoreCreatesAndGets(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		user, err := db.CreateUser("user@example.com", "hash")
+		if err != nil {
+			t.Fatalf("couldn't create user: %v", err)
+		}
+		if user.ID != 1 || user.Role != DefaultRole || user.EmailVerified {
+			t.Errorf("unexpected new user: %+v", user)
+		}
+		got, err := db.GetUserByEmail("user@example.com")
+		if err != nil || got != user {
+			t.Errorf("expected %+v by email, got %+v %v", user, got, err)
+		}
+
+		chirp, err := db.CreateChirp("hello", user.ID)
+		if err != nil {
+			t.Fatalf("couldn't create chirp: %v", err)
+		}
+		gotChirp, err := db.GetChirp(chirp.ID)
+		if err != nil || gotChirp != chirp {
+			t.Errorf("expected %+v, got %+v %v", chirp, gotChirp, err)
+		}
+		byAuthor, err := db.GetChirpsByAuthor(user.ID)
+		if err != nil || len(byAuthor) != 1 || byAuthor[0] != chirp {
+			t.Errorf("expected [%+v] by author, got %v %v", chirp, byAuthor, err)
+		}
+	})
+}
+
+func TestStoreDoesNotReuseDeletedIDs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		db.CreateChirp("first", 1)
+		second, _ := db.CreateChirp("second", 1)
+		err := db.DeleteChirp(second.ID, 1)
+		if err != nil {
+			t.Fatalf("couldn't delete chirp: %v", err)
+		}
+
+		third, err := db.CreateChirp("third", 1)
+		if err != nil {
+			t.Fatalf("couldn't create chirp: %v", err)
+		}
+		if third.ID != second.ID+1 {
+			t.Errorf("expected id %d, got %d", second.ID+1, third.ID)
+		}
+	})
+}
+
+func TestStoreMapsErrors(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		if _, err := db.GetUser(1); err != ErrNotExist {
+			t.Errorf("expected ErrNotExist for a missing user, got %v", err)
+		}
+		if _, err := db.GetUserByEmail("nobody@example.com"); err != ErrNotExist {
+			t.Errorf("expected ErrNotExist for a missing email, got %v", err)
+		}
+		if _, err := db.GetChirp(1); err != ErrNotExist {
+			t.Errorf("expected ErrNotExist for a missing chirp, got %v", err)
+		}
+		if err := db.DeleteChirp(1, 1); err != ErrNotExist {
+			t.Errorf("expected ErrNotExist deleting a missing chirp, got %v", err)
+		}
+
+		user, _ := db.CreateUser("user@example.com", "hash")
+		other, _ := db.CreateUser("other@example.com", "hash")
+		if _, err := db.CreateUser("user@example.com", "hash"); err != ErrAlreadyExists {
+			t.Errorf("expected ErrAlreadyExists for a taken email, got %v", err)
+		}
+		email := "other@example.com"
+		_, err := db.PatchUser(user.ID, UserUpdate{Email: &email}, AuditEvent{Action: AuditUserUpdated})
+		if err != ErrAlreadyExists {
+			t.Errorf("expected ErrAlreadyExists changing to a taken email, got %v", err)
+		}
+
+		chirp, _ := db.CreateChirp("mine", user.ID)
+		if err := db.DeleteChirp(chirp.ID, other.ID); err != ErrAccessDenied {
+			t.Errorf("expected ErrAccessDenied deleting another user's chirp, got %v", err)
+		}
+	})
+}
+
+func TestStoreRotatesRefreshTokens(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		expiresAt := time.Now().Add(time.Hour)
+		first, err := db.CreateRefreshToken("first", 1, expiresAt, Client{UserAgent: "curl/8.0"})
+		if err != nil {
+			t.Fatalf("couldn't create refresh token: %v", err)
+		}
+		second, err := db.RotateRefreshToken("first", "second", expiresAt, Client{UserAgent: "firefox"})
+		if err != nil {
+			t.Fatalf("couldn't rotate refresh token: %v", err)
+		}
+		if second.FamilyID != first.FamilyID || second.UserID != 1 || second.UserAgent != "firefox" {
+			t.Errorf("unexpected rotated token: %+v", second)
+		}
+
+		if _, err := db.RotateRefreshToken("unknown", "x", expiresAt, Client{}); err != ErrNotExist {
+			t.Errorf("expected ErrNotExist for an unknown token, got %v", err)
+		}
+		if _, err := db.RotateRefreshToken("first", "attacker", expiresAt, Client{}); err != ErrTokenReused {
+			t.Fatalf("expected ErrTokenReused, got %v", err)
+		}
+		if _, err := db.RotateRefreshToken("second", "third", expiresAt, Client{}); err != ErrTokenRevoked {
+			t.Errorf("expected the rest of the family to be revoked, got %v", err)
+		}
+
+		db.CreateRefreshToken("expired", 1, time.Now().Add(-time.Minute), Client{})
+		if _, err := db.RotateRefreshToken("expired", "x", expiresAt, Client{}); err != ErrTokenRevoked {
+			t.Errorf("expected ErrTokenRevoked for an expired token, got %v", err)
+		}
+	})
+}
+
+func TestStoreRotatesRefreshTokenOnce(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		expiresAt := time.Now().Add(time.Hour)
+		db.CreateRefreshToken("first", 1, expiresAt, Client{})
+		const workers = 10
+
+		results := make(chan error, workers)
+		for i := 0; i < workers; i++ {
+			go func(i int) {
+				_, err := db.RotateRefreshToken("first", fmt.Sprintf("next-%d", i), expiresAt, Client{})
+				results <- err
+			}(i)
+		}
+		rotated := 0
+		for i := 0; i < workers; i++ {
+			err := <-results
+			switch err {
+			case nil:
+				rotated++
+			case ErrTokenReused, ErrTokenRevoked:
+			default:
+				t.Errorf("unexpected error rotating concurrently: %v", err)
+			}
+		}
+		if rotated != 1 {
+			t.Errorf("expected exactly one rotation to succeed, got %d", rotated)
+		}
+	})
+}
+
+func TestStoreSessions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		expiresAt := time.Now().Add(time.Hour)
+		laptop, _ := db.CreateRefreshToken("laptop", 1, expiresAt, Client{UserAgent: "firefox"})
+		db.CreateRefreshToken("phone", 1, expiresAt, Client{UserAgent: "ios"})
+		db.CreateRefreshToken("other", 2, expiresAt, Client{})
+		db.RotateRefreshToken("laptop", "laptop-2", expiresAt, Client{UserAgent: "firefox", IP: "10.0.0.3"})
+
+		sessions, err := db.ListSessions(1)
+		if err != nil {
+			t.Fatalf("couldn't list sessions: %v", err)
+		}
+		if len(sessions) != 2 || sessions[0].ID != laptop.FamilyID || sessions[0].IP != "10.0.0.3" {
+			t.Fatalf("expected the rotated laptop session first of 2, got %+v", sessions)
+		}
+
+		if err := db.RevokeSession(2, laptop.FamilyID); err != ErrNotExist {
+			t.Errorf("expected another user's session to be hidden, got %v", err)
+		}
+		if err := db.RevokeSession(1, laptop.FamilyID); err != nil {
+			t.Fatalf("couldn't revoke session: %v", err)
+		}
+		if err := db.RevokeUserSessions(1); err != nil {
+			t.Fatalf("couldn't revoke sessions: %v", err)
+		}
+		sessions, _ = db.ListSessions(1)
+		if len(sessions) != 0 {
+			t.Errorf("expected no sessions left, got %+v", sessions)
+		}
+		sessions, _ = db.ListSessions(2)
+		if len(sessions) != 1 {
+			t.Errorf("expected the other user's session to survive, got %+v", sessions)
+		}
+	})
+}
+
+func TestStoreResetDB(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		user, _ := db.CreateUser("user@example.com", "hash")
+		db.CreateChirp("hello", user.ID)
+		db.CreateRefreshToken("token", user.ID, time.Now().Add(time.Hour), Client{})
+
+		err := db.ResetDB()
+		if err != nil {
+			t.Fatalf("couldn't reset db: %v", err)
+		}
+
+		if _, err := db.GetUserByEmail("user@example.com"); err != ErrNotExist {
+			t.Errorf("expected users to be gone, got %v", err)
+		}
+		if chirps, _ := db.GetChirps(); len(chirps) != 0 {
+			t.Errorf("expected chirps to be gone, got %v", chirps)
+		}
+		if sessions, _ := db.ListSessions(user.ID); len(sessions) != 0 {
+			t.Errorf("expected sessions to be gone, got %v", sessions)
+		}
+		again, err := db.CreateUser("user@example.com", "hash")
+		if err != nil || again.ID != 1 {
+			t.Errorf("expected ids to start over, got %+v %v", again, err)
+		}
+	})
+}
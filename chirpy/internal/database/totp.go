@@ -0,0 +1,135 @@
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrTOTPEnabled = errors.New("two-factor authentication is already enabled")
+var ErrTOTPCodeReused = errors.New("TOTP code was already used")
+
+// TOTP is a user's authenticator enrollment. It only guards logins once
+// Enabled, which happens after the user proves their authenticator works.
+// LastStep is the newest TOTP time step redeemed, so a code can't be
+// replayed, and recovery codes are stored hashed like other tokens.
+type TOTP struct {
+	UserID             int       `json:"user_id"`
+	Secret             string    `json:"secret"`
+	Enabled            bool      `json:"enabled"`
+	LastStep           int64     `json:"last_step"`
+	RecoveryCodeHashes []string  `json:"recovery_code_hashes"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// StartTOTPEnrollment stores a new secret for userID that isn't enforced yet,
+// replacing any unfinished enrollment.
+func (db *DB) StartTOTPEnrollment(userID int, secret string) error {
+	return db.Update(func(tx *DBStructure) error {
+		if tx.TOTP[userID].Enabled {
+			return ErrTOTPEnabled
+		}
+		setEntry(tx, "totp", tx.TOTP, userID, TOTP{
+			UserID:             userID,
+			Secret:             secret,
+			RecoveryCodeHashes: []string{},
+			CreatedAt:          time.Now().UTC(),
+		})
+		return nil
+	})
+}
+
+func (db *DB) GetTOTP(userID int) (TOTP, error) {
+	totp := TOTP{}
+	err := db.View(func(tx *DBStructure) error {
+		var ok bool
+		totp, ok = tx.TOTP[userID]
+		if !ok {
+			return ErrNotExist
+		}
+		return nil
+	})
+	if err != nil {
+		return TOTP{}, err
+	}
+	return totp, nil
+}
+
+// EnableTOTP turns on an enrollment once the user has redeemed a code for
+// step, and stores their recovery codes.
+func (db *DB) EnableTOTP(userID int, step int64, recoveryCodes []string) error {
+	return db.Update(func(tx *DBStructure) error {
+		totp, ok := tx.TOTP[userID]
+		if !ok {
+			return ErrNotExist
+		}
+		if totp.Enabled {
+			return ErrTOTPEnabled
+		}
+		totp.Enabled = true
+		totp.LastStep = step
+		totp.RecoveryCodeHashes = hashRecoveryCodes(recoveryCodes)
+		setEntry(tx, "totp", tx.TOTP, userID, totp)
+		return nil
+	})
+}
+
+// UseTOTPStep records that the user redeemed a code for step. It returns
+// ErrTOTPCodeReused if that step, or a later one, was already redeemed.
+func (db *DB) UseTOTPStep(userID int, step int64) error {
+	return db.Update(func(tx *DBStructure) error {
+		totp, ok := tx.TOTP[userID]
+		if !ok || !totp.Enabled {
+			return ErrNotExist
+		}
+		if step <= totp.LastStep {
+			return ErrTOTPCodeReused
+		}
+		totp.LastStep = step
+		setEntry(tx, "totp", tx.TOTP, userID, totp)
+		return nil
+	})
+}
+
+// ConsumeRecoveryCode redeems one of the user's recovery codes. Unknown and
+// already used codes return ErrNotExist.
+func (db *DB) ConsumeRecoveryCode(userID int, code string) error {
+	return db.Update(func(tx *DBStructure) error {
+		totp, ok := tx.TOTP[userID]
+		if !ok || !totp.Enabled {
+			return ErrNotExist
+		}
+		codeHash := hashToken(code)
+		remaining := []string{}
+		for _, recoveryCodeHash := range totp.RecoveryCodeHashes {
+			if recoveryCodeHash != codeHash {
+				remaining = append(remaining, recoveryCodeHash)
+			}
+		}
+		if len(remaining) == len(totp.RecoveryCodeHashes) {
+			return ErrNotExist
+		}
+		totp.RecoveryCodeHashes = remaining
+		setEntry(tx, "totp", tx.TOTP, userID, totp)
+		return nil
+	})
+}
+
+// DisableTOTP removes userID's enrollment and recovery codes, finished or
+// not, so they can log in with just a password or enroll again.
+func (db *DB) DisableTOTP(userID int) error {
+	return db.Update(func(tx *DBStructure) error {
+		if _, ok := tx.TOTP[userID]; !ok {
+			return ErrNotExist
+		}
+		deleteEntry(tx, "totp", tx.TOTP, userID)
+		return nil
+	})
+}
+
+func hashRecoveryCodes(codes []string) []string {
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, hashToken(code))
+	}
+	return hashes
+}
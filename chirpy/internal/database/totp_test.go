@@ -0,0 +1,78 @@
+package database
+
+import "testing"
+
+func TestTOTPCodesAndRecoveryCodesAreSingleUse(t *testing.T) {
+	db := newTestDB(t)
+
+	err := db.StartTOTPEnrollment(1, "SECRET")
+	if err != nil {
+		t.Fatalf("couldn't start enrollment: %v", err)
+	}
+	err = db.UseTOTPStep(1, 100)
+	if err != ErrNotExist {
+		t.Errorf("expected an unfinished enrollment not to accept codes, got %v", err)
+	}
+	err = db.EnableTOTP(1, 100, []string{"aaaaa-aaaaa", "bbbbb-bbbbb"})
+	if err != nil {
+		t.Fatalf("couldn't enable totp: %v", err)
+	}
+	err = db.StartTOTPEnrollment(1, "OTHER")
+	if err != ErrTOTPEnabled {
+		t.Errorf("expected re-enrolling to be refused, got %v", err)
+	}
+
+	err = db.UseTOTPStep(1, 100)
+	if err != ErrTOTPCodeReused {
+		t.Errorf("expected the enrollment code to be spent, got %v", err)
+	}
+	err = db.UseTOTPStep(1, 101)
+	if err != nil {
+		t.Errorf("expected the next code to work, got %v", err)
+	}
+
+	err = db.ConsumeRecoveryCode(1, "aaaaa-aaaaa")
+	if err != nil {
+		t.Fatalf("couldn't consume recovery code: %v", err)
+	}
+	err = db.ConsumeRecoveryCode(1, "aaaaa-aaaaa")
+	if err != ErrNotExist {
+		t.Errorf("expected a used recovery code to be rejected, got %v", err)
+	}
+	totp, err := db.GetTOTP(1)
+	if err != nil {
+		t.Fatalf("couldn't get totp: %v", err)
+	}
+	if !totp.Enabled || totp.Secret != "SECRET" || len(totp.RecoveryCodeHashes) != 1 {
+		t.Errorf("unexpected enrollment %+v", totp)
+	}
+}
+
+func TestDisableTOTPRemovesTheEnrollment(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		user, _ := db.CreateUser("user@example.com", "hash")
+		err := db.DisableTOTP(user.ID)
+		if err != ErrNotExist {
+			t.Errorf("expected disabling without an enrollment to fail, got %v", err)
+		}
+
+		db.StartTOTPEnrollment(user.ID, "SECRET")
+		db.EnableTOTP(user.ID, 100, []string{"aaaaa-aaaaa"})
+		err = db.DisableTOTP(user.ID)
+		if err != nil {
+			t.Fatalf("couldn't disable totp: %v", err)
+		}
+		_, err = db.GetTOTP(user.ID)
+		if err != ErrNotExist {
+			t.Errorf("expected the enrollment to be gone, got %v", err)
+		}
+		err = db.ConsumeRecoveryCode(user.ID, "aaaaa-aaaaa")
+		if err != ErrNotExist {
+			t.Errorf("expected the recovery codes to be gone, got %v", err)
+		}
+		err = db.StartTOTPEnrollment(user.ID, "OTHER")
+		if err != nil {
+			t.Errorf("expected to be able to enroll again, got %v", err)
+		}
+	})
+}
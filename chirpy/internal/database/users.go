@@ -1,36 +1,44 @@
 package database
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
 
 type User struct {
 	ID             int    `json:"id"`
 	Email          string `json:"email"`
 	HashedPassword string `json:"hashed_password"`
 	IsChirpyRed    bool   `json:"is_chirpy_red"`
+	Role           string `json:"role"`
+	EmailVerified  bool   `json:"email_verified"`
 }
 
+// DefaultRole is the role new users are created with.
+const DefaultRole = "user"
+
 var ErrAlreadyExists = errors.New("already exists")
 
 func (db *DB) CreateUser(email, hashedPassword string) (User, error) {
-	if _, err := db.GetUserByEmail(email); !errors.Is(err, ErrNotExist) {
-		return User{}, ErrAlreadyExists
-	}
-
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
-	}
-
-	id := len(dbStructure.Users) + 1
-	user := User{
-		ID:             id,
-		Email:          email,
-		HashedPassword: hashedPassword,
-		IsChirpyRed:    false,
-	}
-	dbStructure.Users[id] = user
+	user := User{}
+	err := db.Update(func(tx *DBStructure) error {
+		if _, ok := findUserByEmail(tx, email); ok {
+			return ErrAlreadyExists
+		}
 
-	err = db.writeDB(dbStructure)
+		id := tx.nextUserID()
+		user = User{
+			ID:             id,
+			Email:          email,
+			HashedPassword: hashedPassword,
+			IsChirpyRed:    false,
+			Role:           DefaultRole,
+		}
+		tx.putUser(user)
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
@@ -39,74 +47,200 @@ func (db *DB) CreateUser(email, hashedPassword string) (User, error) {
 }
 
 func (db *DB) GetUser(id int) (User, error) {
-	dbStructure, err := db.loadDB()
+	user := User{}
+	err := db.View(func(tx *DBStructure) error {
+		var ok bool
+		user, ok = tx.Users[id]
+		if !ok {
+			return ErrNotExist
+		}
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
 
-	user, ok := dbStructure.Users[id]
-	if !ok {
-		return User{}, ErrAlreadyExists
-	}
-
 	return user, nil
 }
 
 func (db *DB) GetUserByEmail(email string) (User, error) {
-	dbStructure, err := db.loadDB()
+	user := User{}
+	err := db.View(func(tx *DBStructure) error {
+		var ok bool
+		user, ok = findUserByEmail(tx, email)
+		if !ok {
+			return ErrNotExist
+		}
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
 
-	for _, user := range dbStructure.Users {
-		if user.Email == email {
-			return user, nil
-		}
+	return user, nil
+}
+
+// UserUpdate holds the user fields to change. Nil fields are left alone.
+type UserUpdate struct {
+	Email          *string
+	HashedPassword *string
+}
+
+// Fields names the fields the update changes, as recorded in audit events.
+func (u UserUpdate) Fields() []string {
+	fields := []string{}
+	if u.Email != nil {
+		fields = append(fields, "email")
+	}
+	if u.HashedPassword != nil {
+		fields = append(fields, "password")
 	}
-	return User{}, ErrNotExist
+	return fields
 }
 
-func (db *DB) UpdateUser(id int, email, hashedPassword string) (User, error) {
-	dbStructure, err := db.loadDB()
+// PatchUser applies update and records event for it in the same
+// transaction. The event's ID, UserID, Fields and CreatedAt are filled in. A
+// new password also revokes every session the user has, in that transaction
+// too, so no session outlives the password it was started with.
+func (db *DB) PatchUser(id int, update UserUpdate, event AuditEvent) (User, error) {
+	user := User{}
+	err := db.Update(func(tx *DBStructure) error {
+		var err error
+		user, err = applyUserUpdate(tx, id, update)
+		if err != nil {
+			return err
+		}
+		if update.HashedPassword != nil {
+			revokeUserSessions(tx, id, time.Now().UTC())
+		}
+		event = newAuditEvent(event, id, update)
+		event.ID = tx.nextAuditEventID()
+		setEntry(tx, "audit_events", tx.AuditEvents, event.ID, event)
+		return nil
+	})
 	if err != nil {
-		return User{}, nil
+		return User{}, err
 	}
 
-	user, ok := dbStructure.Users[id]
+	return user, nil
+}
+
+func applyUserUpdate(tx *DBStructure, id int, update UserUpdate) (User, error) {
+	user, ok := tx.Users[id]
 	if !ok {
 		return User{}, ErrNotExist
 	}
-
-	user.Email = email
-	user.HashedPassword = hashedPassword
-	dbStructure.Users[id] = user
-
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return User{}, err
+	if update.Email != nil {
+		email := *update.Email
+		if existing, ok := findUserByEmail(tx, email); ok && existing.ID != id {
+			return User{}, ErrAlreadyExists
+		}
+		if email != user.Email {
+			user.EmailVerified = false
+			deleteOneTimeTokens(tx, id, PurposeVerifyEmail)
+		}
+		user.Email = email
 	}
-
+	if update.HashedPassword != nil {
+		user.HashedPassword = *update.HashedPassword
+	}
+	tx.putUser(user)
 	return user, nil
 }
 
+// SetEmailVerified marks the user's current email as verified.
+func (db *DB) SetEmailVerified(id int) error {
+	return db.Update(func(tx *DBStructure) error {
+		user, ok := tx.Users[id]
+		if !ok {
+			return ErrNotExist
+		}
+		user.EmailVerified = true
+		tx.putUser(user)
+		return nil
+	})
+}
+
 func (db *DB) UpdateChirpyRedSubscription(id int, isChirpyRed bool) error {
-	dbStructure, err := db.loadDB()
+	return db.Update(func(tx *DBStructure) error {
+		user, ok := tx.Users[id]
+		if !ok {
+			return ErrNotExist
+		}
+		user.IsChirpyRed = isChirpyRed
+		tx.putUser(user)
+		return nil
+	})
+}
+
+// ReplacePasswordHash swaps the user's password hash for an equivalent one,
+// such as after rehashing under a stronger policy. It returns ErrNotExist
+// if the hash is no longer oldHash, so a password changed in the meantime is
+// never reverted.
+func (db *DB) ReplacePasswordHash(id int, oldHash, newHash string) error {
+	return db.Update(func(tx *DBStructure) error {
+		user, ok := tx.Users[id]
+		if !ok || user.HashedPassword != oldHash {
+			return ErrNotExist
+		}
+		user.HashedPassword = newHash
+		tx.putUser(user)
+		return nil
+	})
+}
+
+// seedUserRoles gives users written before roles existed the default role.
+func seedUserRoles(doc map[string]any) error {
+	users, err := objectField(doc, "users")
 	if err != nil {
 		return err
 	}
-	user, ok := dbStructure.Users[id]
-	if !ok {
-		return ErrNotExist
+	for key, v := range users {
+		user, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("user %s is not an object", key)
+		}
+		if stringValue(user["role"]) == "" {
+			user["role"] = DefaultRole
+		}
 	}
-	dbStructure.Users[id] = User{
-		ID:             user.ID,
-		Email:          user.Email,
-		HashedPassword: user.HashedPassword,
-		IsChirpyRed:    isChirpyRed,
+	return nil
+}
+
+// ListUsers returns every user ordered by ID.
+func (db *DB) ListUsers() ([]User, error) {
+	users := []User{}
+	err := db.View(func(tx *DBStructure) error {
+		for _, user := range tx.Users {
+			users = append(users, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	err = db.writeDB(dbStructure)
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return users, nil
+}
+
+func (db *DB) UpdateUserRole(id int, role string) (User, error) {
+	user := User{}
+	err := db.Update(func(tx *DBStructure) error {
+		var ok bool
+		user, ok = tx.Users[id]
+		if !ok {
+			return ErrNotExist
+		}
+		user.Role = role
+		tx.putUser(user)
+		return nil
+	})
 	if err != nil {
-		return err
+		return User{}, err
 	}
-	return nil
+
+	return user, nil
 }
@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDirMailerWritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	m := DirMailer{Dir: dir, From: "chirpy@example.com"}
+
+	err := m.Send(Message{
+		To:      "a@b.com\r\nBcc: victim@example.com",
+		Subject: "Reset your password",
+		Body:    "token: abc",
+	})
+	if err != nil {
+		t.Fatalf("couldn't send: %v", err)
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(paths) != 1 {
+		t.Fatalf("expected one message, got %v", paths)
+	}
+	dat, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(dat)
+	if !strings.Contains(msg, "Subject: Reset your password\r\n") || !strings.HasSuffix(msg, "\r\n\r\ntoken: abc") {
+		t.Errorf("unexpected message:\n%s", msg)
+	}
+	if strings.Contains(msg, "\r\nBcc:") {
+		t.Errorf("expected header injection to be stripped:\n%s", msg)
+	}
+}
@@ -0,0 +1,105 @@
+package validation
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy is what a new password has to satisfy. Lengths count
+// characters, not bytes.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MinClasses is how many of lowercase letters, uppercase letters,
+	// digits and symbols the password must mix.
+	MinClasses     int
+	RejectBreached bool
+}
+
+// DefaultPasswordPolicy follows NIST SP 800-63B: a minimum length and a
+// breached-password check do more than composition rules, so it only asks
+// for two character classes.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:      8,
+	MaxLength:      256,
+	MinClasses:     2,
+	RejectBreached: true,
+}
+
+// Check returns an error describing the first rule password breaks. email
+// is the account's address, which the password mustn't contain.
+func (p PasswordPolicy) Check(password, email string) error {
+	length := utf8.RuneCountInString(password)
+	if length == 0 {
+		return errors.New("Password is required")
+	}
+	if length < p.MinLength {
+		return fmt.Errorf("Password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("Password must be at most %d characters", p.MaxLength)
+	}
+	if characterClasses(password) < p.MinClasses {
+		return fmt.Errorf("Password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinClasses)
+	}
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	if len(local) >= 3 && strings.Contains(strings.ToLower(password), local) {
+		return errors.New("Password must not contain your email address")
+	}
+	if p.RejectBreached && IsBreached(password) {
+		return errors.New("Password is too common and appears in known data breaches")
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, ok := range []bool{lower, upper, digit, symbol} {
+		if ok {
+			classes++
+		}
+	}
+	return classes
+}
+
+//go:embed breached_passwords.txt
+var breachedPasswordList string
+
+var breachedPasswords = sync.OnceValue(func() map[string]struct{} {
+	set := map[string]struct{}{}
+	scanner := bufio.NewScanner(strings.NewReader(breachedPasswordList))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[line] = struct{}{}
+	}
+	return set
+})
+
+// IsBreached reports whether password, ignoring case, is on the bundled list
+// of passwords known from public breaches.
+func IsBreached(password string) bool {
+	_, ok := breachedPasswords()[strings.ToLower(password)]
+	return ok
+}
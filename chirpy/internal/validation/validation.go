@@ -0,0 +1,68 @@
+// Package validation checks and normalizes the credentials users sign up
+// with.
+package validation
+
+import (
+	"errors"
+	"net/mail"
+	"sort"
+	"strings"
+)
+
+const maxEmailLength = 254
+
+// FieldErrors maps a request field's JSON name to what is wrong with it.
+type FieldErrors map[string]string
+
+func (f FieldErrors) Error() string {
+	fields := make([]string, 0, len(f))
+	for field, msg := range f {
+		fields = append(fields, field+": "+msg)
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, "; ")
+}
+
+// NormalizeEmail trims email and lowercases its domain, which is case
+// insensitive. The local part is left alone since mail servers may treat
+// it case sensitively. It returns an error for anything that isn't a plain
+// address like name@example.com.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", errors.New("Email is required")
+	}
+	if len(email) > maxEmailLength {
+		return "", errors.New("Email is too long")
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", errors.New("Email is not a valid email address")
+	}
+	at := strings.LastIndex(email, "@")
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+	if !validDomain(domain) {
+		return "", errors.New("Email is not a valid email address")
+	}
+	return local + "@" + domain, nil
+}
+
+// validDomain accepts dotted hostnames, rejecting address literals and
+// single-label names no one can receive mail at.
+func validDomain(domain string) bool {
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, c := range label {
+			if c != '-' && (c < 'a' || c > 'z') && (c < '0' || c > '9') && c < 0x80 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	valid := map[string]string{
+		"a@b.com":                         "a@b.com",
+		"  Alice@Example.COM ":            "Alice@example.com",
+		"first.last+tag@mail.example.org": "first.last+tag@mail.example.org",
+	}
+	for in, want := range valid {
+		got, err := NormalizeEmail(in)
+		if err != nil || got != want {
+			t.Errorf("NormalizeEmail(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"   ",
+		"no-at-sign",
+		"a@localhost",
+		"a@[127.0.0.1]",
+		"Alice <a@b.com>",
+		"a@b..com",
+		"a@-b.com",
+		"a@b.com, c@d.com",
+		strings.Repeat("a", 250) + "@b.com",
+	}
+	for _, in := range invalid {
+		_, err := NormalizeEmail(in)
+		if err == nil {
+			t.Errorf("expected %q to be rejected", in)
+		}
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := DefaultPasswordPolicy
+	cases := map[string]bool{
+		"":                        false,
+		"Ab1!":                    false,
+		"alllowercase":            false,
+		"Password1":               false,
+		"PASSWORD123":             false,
+		"Alice-rocks-99":          false,
+		"correct horse battery":   true,
+		"Tr0ubadour&3":            true,
+		strings.Repeat("aB", 200): false,
+	}
+	for password, ok := range cases {
+		err := policy.Check(password, "alice@example.com")
+		if (err == nil) != ok {
+			t.Errorf("Check(%q) = %v, expected ok=%v", password, err, ok)
+		}
+	}
+
+	relaxed := PasswordPolicy{MinLength: 4}
+	if err := relaxed.Check("password", "alice@example.com"); err != nil {
+		t.Errorf("expected a policy without the breach check to accept it, got %v", err)
+	}
+}
+
+func TestBreachedListIsLoaded(t *testing.T) {
+	if !IsBreached("Password123") || !IsBreached("qwertyuiop") {
+		t.Error("expected common passwords to be on the breached list")
+	}
+	if IsBreached("# Common passwords seen in public breach corpora, one per line, lowercase.") {
+		t.Error("expected comment lines to be skipped")
+	}
+}
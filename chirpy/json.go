@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/validation"
 )
 
 func respondWithError(w http.ResponseWriter, code int, msg string) {
@@ -18,6 +20,19 @@ func respondWithError(w http.ResponseWriter, code int, msg string) {
 	})
 }
 
+// respondWithFieldErrors responds 400 with what is wrong with each invalid
+// request field, keyed by the field's JSON name.
+func respondWithFieldErrors(w http.ResponseWriter, fields validation.FieldErrors) {
+	type errorResponse struct {
+		Error  string                 `json:"error"`
+		Fields validation.FieldErrors `json:"fields"`
+	}
+	respondWithJSON(w, http.StatusBadRequest, errorResponse{
+		Error:  "Invalid parameters",
+		Fields: fields,
+	})
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	dat, err := json.Marshal(payload)
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
+)
+
+// tokenConfig reads how access tokens are signed: the keyring, plus the
+// issuer and audience from JWT_ISSUER and JWT_AUDIENCE.
+func tokenConfig() (auth.TokenConfig, error) {
+	keys, err := loadKeyring()
+	if err != nil {
+		return auth.TokenConfig{}, err
+	}
+	cfg := auth.TokenConfig{
+		Keys:     keys,
+		Issuer:   os.Getenv("JWT_ISSUER"),
+		Audience: os.Getenv("JWT_AUDIENCE"),
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = "chirpy"
+	}
+	if cfg.Audience == "" {
+		cfg.Audience = "chirpy"
+	}
+	return cfg, nil
+}
+
+// loadKeyring reads the JWT signing keys from the file or directory named by
+// JWT_KEYS and reloads them on SIGHUP. Without JWT_KEYS it falls back to a
+// single key from JWT_SECRET, which can't be rotated without a restart.
+func loadKeyring() (*auth.Keyring, error) {
+	path := os.Getenv("JWT_KEYS")
+	if path == "" {
+		jwtSecret := os.Getenv("JWT_SECRET")
+		if jwtSecret == "" {
+			return nil, errors.New("JWT_KEYS or JWT_SECRET environment variable must be set")
+		}
+		return auth.NewKeyring([]auth.Key{{ID: auth.LegacyKeyID, Secret: jwtSecret}}, auth.LegacyKeyID)
+	}
+
+	keys, err := auth.LoadKeyring(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			err := keys.Reload(path)
+			if err != nil {
+				log.Printf("Couldn't reload JWT keys, keeping the current ones: %s", err)
+				continue
+			}
+			log.Printf("Reloaded JWT keys from %s, signing with %q", path, keys.ActiveKeyID())
+		}
+	}()
+	return keys, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+)
+
+const (
+	// loginFailureWindow is how long a failed login counts against an
+	// account or IP after the most recent failure.
+	loginFailureWindow = 15 * time.Minute
+	// loginFreeFailures is how many failures are allowed before each
+	// further attempt has to wait, doubling from loginBackoffBase.
+	loginFreeFailures = 3
+	loginBackoffBase  = time.Second
+	loginBackoffMax   = time.Minute
+)
+
+// loginLimit is when failed logins for one kind of key stop being retried
+// with backoff and lock the key out for the rest of loginFailureWindow.
+type loginLimit struct {
+	lockAfter    int
+	lockedStatus int
+}
+
+var (
+	// An account lockout is 423 Locked; admins can lift it early.
+	accountLoginLimit = loginLimit{lockAfter: 10, lockedStatus: http.StatusLocked}
+	// IPs get more room since many users can share one.
+	ipLoginLimit = loginLimit{lockAfter: 100, lockedStatus: http.StatusTooManyRequests}
+)
+
+// accountThrottleKey is keyed on the normalized email rather than the user,
+// so attempts against an unknown email are throttled and locked out exactly
+// like ones against a real account and can't be told apart from them.
+func accountThrottleKey(email string) string {
+	return "email:" + normalizedEmail(email)
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginRetryAt returns when the next login attempt is allowed after
+// throttle's failures, and whether the key is locked out until then.
+func loginRetryAt(throttle database.LoginThrottle, limit loginLimit) (time.Time, bool) {
+	if throttle.Failures >= limit.lockAfter {
+		return throttle.ExpiresAt, true
+	}
+	if throttle.Failures <= loginFreeFailures {
+		return time.Time{}, false
+	}
+	backoff := loginBackoffBase << (throttle.Failures - loginFreeFailures - 1)
+	if backoff > loginBackoffMax || backoff <= 0 {
+		backoff = loginBackoffMax
+	}
+	return throttle.LastFailureAt.Add(backoff), false
+}
+
+// reserveLoginAttempt counts an attempt against key as failed before the
+// password is compared, in the same transaction that checks it is allowed,
+// so parallel guesses can't all get past the check before any of them is
+// recorded. It responds and returns false if key has to wait. Attempts that
+// don't fail are taken back with releaseLoginAttempts.
+func (cfg *apiConfig) reserveLoginAttempt(w http.ResponseWriter, key string, limit loginLimit) bool {
+	throttle, err := cfg.DB.ReserveLoginAttempt(key, time.Now().UTC(), loginFailureWindow, func(throttle database.LoginThrottle) time.Time {
+		retryAt, _ := loginRetryAt(throttle, limit)
+		return retryAt
+	})
+	if errors.Is(err, database.ErrLoginThrottled) {
+		retryAt, locked := loginRetryAt(throttle, limit)
+		wait := time.Until(retryAt)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		if locked {
+			respondWithError(w, limit.lockedStatus, "Too many failed logins, try again later")
+			return false
+		}
+		respondWithError(w, http.StatusTooManyRequests, "Too many failed logins, slow down")
+		return false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check login attempts")
+		return false
+	}
+	return true
+}
+
+// releaseLoginAttempts takes back attempts reserved against each key that
+// turned out not to fail.
+func (cfg *apiConfig) releaseLoginAttempts(keys ...string) {
+	for _, key := range keys {
+		err := cfg.DB.ReleaseLoginAttempt(key)
+		if err != nil {
+			log.Printf("Couldn't release login attempt for %s: %s", key, err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+)
+
+func TestLoginRetryAt(t *testing.T) {
+	last := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	expires := last.Add(loginFailureWindow)
+	limit := loginLimit{lockAfter: 10, lockedStatus: http.StatusLocked}
+	roomy := loginLimit{lockAfter: 100, lockedStatus: http.StatusTooManyRequests}
+
+	tests := []struct {
+		name       string
+		failures   int
+		limit      loginLimit
+		wantWait   time.Duration
+		wantLocked bool
+	}{
+		{"no failures", 0, limit, 0, false},
+		{"last free failure", loginFreeFailures, limit, 0, false},
+		{"first backoff", loginFreeFailures + 1, limit, time.Second, false},
+		{"backoff doubles", loginFreeFailures + 2, limit, 2 * time.Second, false},
+		{"just under the lockout", 9, limit, 32 * time.Second, false},
+		{"locked out", 10, limit, loginFailureWindow, true},
+		{"past the lockout", 11, limit, loginFailureWindow, true},
+		{"backoff is capped", 20, roomy, loginBackoffMax, false},
+		{"backoff doesn't overflow", 90, roomy, loginBackoffMax, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retryAt, locked := loginRetryAt(database.LoginThrottle{
+				Failures:      tt.failures,
+				LastFailureAt: last,
+				ExpiresAt:     expires,
+			}, tt.limit)
+			want := time.Time{}
+			if tt.wantWait > 0 {
+				want = last.Add(tt.wantWait)
+			}
+			if !retryAt.Equal(want) || locked != tt.wantLocked {
+				t.Errorf("expected %v (locked %v), got %v (locked %v)", want, tt.wantLocked, retryAt, locked)
+			}
+		})
+	}
+}
+
+// TestLoginBacksOff also checks that an unknown email is throttled exactly
+// like a real one. Each email logs in from its own IP so only the account
+// key is in play.
+func TestLoginBacksOff(t *testing.T) {
+	api := newTestAPI(t)
+	api.createUser("user@example.com", "password")
+
+	for i, email := range []string{"user@example.com", "nobody@example.com"} {
+		addr := "192.0.2." + strconv.Itoa(10+i) + ":1234"
+		statuses := []int{}
+		for j := 0; j <= loginFreeFailures+1; j++ {
+			w := api.doFrom(addr, "POST", "/api/login", "", map[string]string{"email": email, "password": "wrong password"})
+			statuses = append(statuses, w.Code)
+		}
+		w := api.doFrom(addr, "POST", "/api/login", "", map[string]string{"email": email, "password": "password"})
+		statuses = append(statuses, w.Code)
+
+		want := []int{401, 401, 401, 401, 429, 429}
+		if !slices.Equal(statuses, want) {
+			t.Errorf("%s: expected statuses %v, got %v", email, want, statuses)
+		}
+		if got := w.Header().Get("Retry-After"); got != "1" {
+			t.Errorf("%s: expected Retry-After 1, got %q", email, got)
+		}
+	}
+}
+
+func TestLoginLocksOutAccounts(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("user@example.com", "password")
+	admin := api.createUser("admin@example.com", "password")
+	admin.Role = string(auth.RoleAdmin)
+
+	for _, email := range []string{"user@example.com", "nobody@example.com"} {
+		failLogins(t, api, accountThrottleKey(email), accountLoginLimit.lockAfter)
+		w := api.do("POST", "/api/login", "", map[string]string{"email": email, "password": "password"})
+		if w.Code != http.StatusLocked {
+			t.Errorf("%s: expected 423 even with the right password, got %d", email, w.Code)
+		}
+		if got := w.Header().Get("Retry-After"); got != strconv.Itoa(int(loginFailureWindow.Seconds())) {
+			t.Errorf("%s: expected Retry-After for the rest of the window, got %q", email, got)
+		}
+	}
+
+	w := api.do("DELETE", "/admin/users/"+strconv.Itoa(user.ID)+"/lockout", api.accessToken(admin), nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("couldn't unlock user: %d %s", w.Code, w.Body)
+	}
+	api.login("user@example.com", "password")
+}
+
+func TestLoginLimitsIPs(t *testing.T) {
+	api := newTestAPI(t)
+	api.createUser("user@example.com", "password")
+
+	failLogins(t, api, ipThrottleKey("192.0.2.1"), ipLoginLimit.lockAfter)
+	w := api.do("POST", "/api/login", "", map[string]string{"email": "user@example.com", "password": "password"})
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected a locked out IP to get 429, got %d", w.Code)
+	}
+	_, err := api.cfg.DB.GetLoginThrottle(accountThrottleKey("user@example.com"))
+	if !errors.Is(err, database.ErrNotExist) {
+		t.Errorf("expected the account not to be charged for a refused attempt, got %v", err)
+	}
+	w = api.doFrom("198.51.100.1:1234", "POST", "/api/login", "", map[string]string{"email": "user@example.com", "password": "password"})
+	if w.Code != http.StatusOK {
+		t.Errorf("expected another IP to log in, got %d", w.Code)
+	}
+}
+
+func TestSuccessfulLoginClearsAccountFailures(t *testing.T) {
+	api := newTestAPI(t)
+	api.createUser("user@example.com", "password")
+
+	for i := 0; i < loginFreeFailures; i++ {
+		api.do("POST", "/api/login", "", map[string]string{"email": "user@example.com", "password": "wrong password"})
+	}
+	api.login("user@example.com", "password")
+
+	_, err := api.cfg.DB.GetLoginThrottle(accountThrottleKey("user@example.com"))
+	if !errors.Is(err, database.ErrNotExist) {
+		t.Errorf("expected the account's failures to be cleared, got %v", err)
+	}
+	throttle, err := api.cfg.DB.GetLoginThrottle(ipThrottleKey("192.0.2.1"))
+	if err != nil || throttle.Failures != loginFreeFailures {
+		t.Errorf("expected the IP to keep its %d failures, got %+v (%v)", loginFreeFailures, throttle, err)
+	}
+}
+
+// failLogins records n failed attempts against key without waiting out the
+// backoff between them.
+func failLogins(t *testing.T, api *testAPI, key string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		_, err := api.cfg.DB.ReserveLoginAttempt(key, time.Now().UTC(), loginFailureWindow, func(database.LoginThrottle) time.Time {
+			return time.Time{}
+		})
+		if err != nil {
+			t.Fatalf("couldn't record failure: %v", err)
+		}
+	}
+}
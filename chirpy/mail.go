@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/mailer"
+)
+
+// mailerConfig picks how email is sent from MAILER. "dir", the default,
+// writes messages into MAIL_DIR instead of sending them; "smtp" sends through
+// SMTP_ADDR, authenticating with SMTP_USERNAME and SMTP_PASSWORD if set.
+func mailerConfig() (mailer.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "chirpy@localhost"
+	}
+
+	switch os.Getenv("MAILER") {
+	case "", "dir":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "outbox"
+		}
+		return mailer.DirMailer{Dir: dir, From: from}, nil
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			return nil, fmt.Errorf("SMTP_ADDR environment variable is not set")
+		}
+		m := mailer.SMTPMailer{Addr: addr, From: from}
+		if username := os.Getenv("SMTP_USERNAME"); username != "" {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SMTP_ADDR: %w", err)
+			}
+			m.Auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", os.Getenv("MAILER"))
+	}
+}
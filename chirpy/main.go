@@ -2,42 +2,109 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
 	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+	"github.com/Kristian-Roopnarine/chirpy/internal/mailer"
+	"github.com/Kristian-Roopnarine/chirpy/internal/validation"
 	"github.com/joho/godotenv"
 )
 
 type apiConfig struct {
 	fileserverHits int
-	DB             *database.DB
-	jwtSecret      string
+	DB             database.Store
+	tokens         auth.TokenConfig
 	polkaApiKey    string
+	dbName         string
+	snapshots      database.SnapshotPolicy
+	mailer         mailer.Mailer
+	publicURL      string
+	passwords      validation.PasswordPolicy
+
+	emailVerificationRequired bool
 }
 
 func main() {
 	const filepathRoot = "."
 	const port = "8080"
 	godotenv.Load(".env")
-	jwtSecret := os.Getenv("JWT_SECRET")
-	polkaApiKey := os.Getenv("POLKA_API_KEY")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		err := runCommand(os.Args[1], os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	dbg := flag.Bool("debug", false, "Enable debug mode")
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "List pending database migrations and exit")
+	flag.Parse()
+
+	dbDriver, dbPath := dbConfig()
+
+	if *migrateDryRun {
+		if dbDriver != database.DriverJSON {
+			log.Fatalf("-migrate-dry-run is only supported for the %s driver", database.DriverJSON)
+		}
+		pending, err := database.Migrate(dbPath, true)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(pending) == 0 {
+			log.Printf("%s is up to date", dbPath)
+		}
+		for _, m := range pending {
+			log.Printf("would apply migration %d: %s", m.Version, m.Description)
+		}
+		return
+	}
+
+	tokens, err := tokenConfig()
+	if err != nil {
+		log.Fatal(err)
 	}
 
+	polkaApiKey := os.Getenv("POLKA_API_KEY")
 	if polkaApiKey == "" {
 		log.Fatal("POLKA_API_KEY environment variable is not set")
 	}
 
-	db, err := database.NewDB("database.json")
+	snapshots, err := snapshotPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mail, err := mailerConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	passwords, err := passwordPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:" + port
+	}
+
+	dbOpts := []database.Option{}
+	if os.Getenv("DB_JOURNAL") == "true" {
+		dbOpts = append(dbOpts, database.WithJournal(database.JournalPath(dbPath)))
+	}
+
+	db, err := database.Open(dbDriver, dbPath, dbOpts...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	dbg := flag.Bool("debug", false, "Enable debug mode")
-	flag.Parse()
 	if dbg != nil && *dbg {
 		err := db.ResetDB()
 		if err != nil {
@@ -45,38 +112,124 @@ func main() {
 		}
 	}
 
+	compactInterval := time.Hour
+	if interval := os.Getenv("REFRESH_TOKEN_COMPACT_INTERVAL"); interval != "" {
+		compactInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("invalid REFRESH_TOKEN_COMPACT_INTERVAL: %s", err)
+		}
+	}
+	startCompactor(db, compactInterval)
+
 	apiCfg := apiConfig{
 		fileserverHits: 0,
 		DB:             db,
-		jwtSecret:      jwtSecret,
+		tokens:         tokens,
 		polkaApiKey:    polkaApiKey,
+		dbName:         filepath.Base(dbPath),
+		snapshots:      snapshots,
+		mailer:         mail,
+		publicURL:      strings.TrimSuffix(publicURL, "/"),
+		passwords:      passwords,
+
+		emailVerificationRequired: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+	}
+
+	corsMux := middlewareCors(apiCfg.routes(filepathRoot))
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: corsMux,
 	}
+	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
+	log.Fatal(srv.ListenAndServe())
+}
 
+// routes registers every endpoint, serving the app's static files from
+// filepathRoot.
+func (cfg *apiConfig) routes(filepathRoot string) *http.ServeMux {
 	mux := http.NewServeMux()
-	fsHandler := apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer((http.Dir(filepathRoot)))))
+	fsHandler := cfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer((http.Dir(filepathRoot)))))
 	mux.Handle("/app/*", fsHandler)
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
-	mux.HandleFunc("GET /api/reset", apiCfg.handlerReset)
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.handlerJWKS)
+	mux.Handle("GET /api/reset", cfg.requireRole(auth.RoleAdmin, cfg.handlerReset))
 
-	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
-	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
-	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
+	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
+	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
+	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
+	mux.HandleFunc("POST /api/login/totp", cfg.handlerLoginTOTP)
+	mux.HandleFunc("POST /api/password-reset", cfg.handlerPasswordResetRequest)
+	mux.HandleFunc("POST /api/password-reset/confirm", cfg.handlerPasswordResetConfirm)
 
-	mux.HandleFunc("POST /api/users", apiCfg.handlerUsersCreate)
-	mux.HandleFunc("PUT /api/users", apiCfg.handlerUsersUpdate)
+	mux.Handle("GET /api/sessions", cfg.requireAuth(auth.ScopeAccount, cfg.handlerSessionsList))
+	mux.Handle("DELETE /api/sessions", cfg.requireAuth(auth.ScopeAccount, cfg.handlerSessionsDeleteAll))
+	mux.Handle("DELETE /api/sessions/{sessionID}", cfg.requireAuth(auth.ScopeAccount, cfg.handlerSessionDelete))
 
-	mux.HandleFunc("POST /api/chirps", apiCfg.handlerChirpsCreate)
-	mux.HandleFunc("GET /api/chirps", apiCfg.handlerChirpsRetrieve)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerChirpsGet)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerChirpDelete)
+	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.Handle("PUT /api/users", cfg.requireAuth(auth.ScopeAccount, cfg.handlerUsersUpdate))
+	mux.Handle("PATCH /api/users", cfg.requireAuth(auth.ScopeAccount, cfg.handlerUsersPatch))
+	mux.Handle("POST /api/email-verification", cfg.requireAuth(auth.ScopeAccount, cfg.handlerEmailVerificationResend))
+	mux.HandleFunc("POST /api/email-verification/confirm", cfg.handlerEmailVerificationConfirm)
+	mux.Handle("POST /api/totp", cfg.requireAuth(auth.ScopeAccount, cfg.handlerTOTPEnroll))
+	mux.Handle("POST /api/totp/verify", cfg.requireAuth(auth.ScopeAccount, cfg.handlerTOTPVerify))
+	mux.Handle("DELETE /api/totp", cfg.requireAuth(auth.ScopeAccount, cfg.handlerTOTPDisable))
 
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerWebhook)
+	mux.Handle("POST /api/chirps", cfg.requireAuth(auth.ScopeChirpsWrite, cfg.handlerChirpsCreate))
+	mux.HandleFunc("GET /api/chirps", cfg.handlerChirpsRetrieve)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handlerChirpsGet)
+	mux.Handle("DELETE /api/chirps/{chirpID}", cfg.requireAuth(auth.ScopeChirpsWrite, cfg.handlerChirpDelete))
 
-	corsMux := middlewareCors(mux)
-	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: corsMux,
+	mux.HandleFunc("POST /api/polka/webhooks", cfg.handlerWebhook)
+
+	mux.Handle("GET /admin/metrics", cfg.requireRole(auth.RoleAdmin, cfg.handlerMetrics))
+	mux.Handle("GET /admin/users", cfg.requireRole(auth.RoleAdmin, cfg.handlerAdminUsersList))
+	mux.Handle("PUT /admin/users/{userID}/role", cfg.requireRole(auth.RoleAdmin, cfg.handlerAdminUserRoleUpdate))
+	mux.Handle("DELETE /admin/users/{userID}/lockout", cfg.requireRole(auth.RoleAdmin, cfg.handlerAdminUserUnlock))
+	mux.Handle("GET /admin/users/{userID}/audit", cfg.requireRole(auth.RoleAdmin, cfg.handlerAdminUserAudit))
+	mux.Handle("POST /admin/snapshots", cfg.requireRole(auth.RoleAdmin, cfg.handlerSnapshotCreate))
+	return mux
+}
+
+// dbConfig reads the storage backend and file path from DB_DRIVER and
+// DB_PATH, defaulting to the JSON store in database.json.
+func dbConfig() (driver, path string) {
+	driver = os.Getenv("DB_DRIVER")
+	if driver == "" {
+		driver = database.DriverJSON
 	}
-	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
-	log.Fatal(srv.ListenAndServe())
+	path = os.Getenv("DB_PATH")
+	if path == "" {
+		path = "database.json"
+		if driver == database.DriverSQLite {
+			path = "database.db"
+		}
+	}
+	return driver, path
+}
+
+// snapshotPolicy reads where database snapshots are written and how many are
+// kept from SNAPSHOT_DIR, SNAPSHOT_KEEP and SNAPSHOT_MAX_AGE.
+func snapshotPolicy() (database.SnapshotPolicy, error) {
+	policy := database.SnapshotPolicy{
+		Dir:  os.Getenv("SNAPSHOT_DIR"),
+		Keep: 7,
+	}
+	if policy.Dir == "" {
+		policy.Dir = "snapshots"
+	}
+	if keep := os.Getenv("SNAPSHOT_KEEP"); keep != "" {
+		n, err := strconv.Atoi(keep)
+		if err != nil {
+			return policy, fmt.Errorf("invalid SNAPSHOT_KEEP: %w", err)
+		}
+		policy.Keep = n
+	}
+	if maxAge := os.Getenv("SNAPSHOT_MAX_AGE"); maxAge != "" {
+		d, err := time.ParseDuration(maxAge)
+		if err != nil {
+			return policy, fmt.Errorf("invalid SNAPSHOT_MAX_AGE: %w", err)
+		}
+		policy.MaxAge = d
+	}
+	return policy, nil
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+	"github.com/Kristian-Roopnarine/chirpy/internal/mailer"
+	"github.com/Kristian-Roopnarine/chirpy/internal/validation"
+)
+
+const testRemoteAddr = "192.0.2.1:1234"
+
+// testAPI serves the same routes as main on a fresh JSON database, and
+// writes mail to a temporary directory.
+type testAPI struct {
+	t       *testing.T
+	cfg     *apiConfig
+	handler http.Handler
+	mailDir string
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatalf("couldn't create db: %v", err)
+	}
+	keys, err := auth.NewKeyring([]auth.Key{{ID: auth.LegacyKeyID, Secret: "secret"}}, auth.LegacyKeyID)
+	if err != nil {
+		t.Fatalf("couldn't create keyring: %v", err)
+	}
+	mailDir := filepath.Join(t.TempDir(), "mail")
+	cfg := &apiConfig{
+		DB:          db,
+		tokens:      auth.TokenConfig{Keys: keys, Issuer: "chirpy", Audience: "chirpy"},
+		polkaApiKey: "polka",
+		dbName:      "database.json",
+		mailer:      mailer.DirMailer{Dir: mailDir, From: "chirpy@example.com"},
+		publicURL:   "http://chirpy.test",
+		passwords:   validation.PasswordPolicy{MinLength: 8, MaxLength: 256},
+	}
+	return &testAPI{t: t, cfg: cfg, handler: cfg.routes(t.TempDir()), mailDir: mailDir}
+}
+
+// do sends body as JSON from testRemoteAddr, with token as the bearer token
+// unless it is empty.
+func (api *testAPI) do(method, path, token string, body any) *httptest.ResponseRecorder {
+	return api.doFrom(testRemoteAddr, method, path, token, body)
+}
+
+func (api *testAPI) doFrom(remoteAddr, method, path, token string, body any) *httptest.ResponseRecorder {
+	api.t.Helper()
+	dat, err := json.Marshal(body)
+	if err != nil {
+		api.t.Fatalf("couldn't encode body: %v", err)
+	}
+	r := httptest.NewRequest(method, path, bytes.NewReader(dat))
+	r.RemoteAddr = remoteAddr
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	api.handler.ServeHTTP(w, r)
+	return w
+}
+
+// createUser stores a user directly, skipping the password policy.
+func (api *testAPI) createUser(email, password string) database.User {
+	api.t.Helper()
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		api.t.Fatalf("couldn't hash password: %v", err)
+	}
+	user, err := api.cfg.DB.CreateUser(email, hashedPassword)
+	if err != nil {
+		api.t.Fatalf("couldn't create user: %v", err)
+	}
+	return user
+}
+
+func (api *testAPI) accessToken(user database.User) string {
+	api.t.Helper()
+	token, err := auth.MakeJWT(accessClaims(user), api.cfg.tokens, accessTokenTTL)
+	if err != nil {
+		api.t.Fatalf("couldn't make token: %v", err)
+	}
+	return token
+}
+
+type testLogin struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (api *testAPI) login(email, password string) testLogin {
+	api.t.Helper()
+	w := api.do("POST", "/api/login", "", map[string]string{"email": email, "password": password})
+	if w.Code != http.StatusOK {
+		api.t.Fatalf("couldn't log in as %s: %d %s", email, w.Code, w.Body)
+	}
+	login := testLogin{}
+	decodeResponse(api.t, w, &login)
+	return login
+}
+
+var mailTokenPattern = regexp.MustCompile(`token=(\S+)`)
+
+// mailToken waits for the newest email to to arrive and returns the token
+// from the link in it.
+func (api *testAPI) mailToken(to string) string {
+	api.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		entries, _ := os.ReadDir(api.mailDir)
+		for i := len(entries) - 1; i >= 0; i-- {
+			if !strings.HasSuffix(entries[i].Name(), "-"+to+".eml") {
+				continue
+			}
+			dat, err := os.ReadFile(filepath.Join(api.mailDir, entries[i].Name()))
+			if err != nil {
+				api.t.Fatalf("couldn't read mail: %v", err)
+			}
+			match := mailTokenPattern.FindSubmatch(dat)
+			if match == nil {
+				api.t.Fatalf("no token in mail to %s:\n%s", to, dat)
+			}
+			token, err := url.QueryUnescape(string(match[1]))
+			if err != nil {
+				api.t.Fatalf("couldn't unescape token: %v", err)
+			}
+			return token
+		}
+		if time.Now().After(deadline) {
+			api.t.Fatalf("no mail to %s", to)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	err := json.Unmarshal(w.Body.Bytes(), v)
+	if err != nil {
+		t.Fatalf("couldn't decode response %q: %v", w.Body, err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
+)
+
+// Principal is the authenticated user a request is made on behalf of.
+type Principal struct {
+	UserID int
+	Claims auth.Claims
+}
+
+type principalKey struct{}
+
+// principalFromContext returns the principal requireAuth stored in ctx. It
+// panics if the route isn't wrapped in requireAuth, which is a wiring bug.
+func principalFromContext(ctx context.Context) Principal {
+	return ctx.Value(principalKey{}).(Principal)
+}
+
+// requireAuth validates the request's access token and checks it grants
+// scope before calling next with the Principal in the request context. Every
+// authentication failure gets the same 401 so clients can't tell a missing
+// token from a bad one.
+func (cfg *apiConfig) requireAuth(scope string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondUnauthorized(w)
+			return
+		}
+		claims, err := auth.ValidateJWT(token, cfg.tokens)
+		if err != nil {
+			respondUnauthorized(w)
+			return
+		}
+		if !claims.HasScope(scope) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+			respondWithError(w, http.StatusForbidden, "Token is missing the "+scope+" scope")
+			return
+		}
+		// ValidateJWT has already checked the subject parses.
+		userID, _ := claims.UserID()
+
+		ctx := context.WithValue(r.Context(), principalKey{}, Principal{
+			UserID: userID,
+			Claims: claims,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func respondUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+}
+
+// requireRole is requireAuth for routes that need role or higher. The role
+// comes from the token, so a demotion takes effect when the user's current
+// access token expires.
+func (cfg *apiConfig) requireRole(role auth.Role, next http.HandlerFunc) http.Handler {
+	return cfg.requireAuth(auth.ScopeAccount, func(w http.ResponseWriter, r *http.Request) {
+		principal := principalFromContext(r.Context())
+		if !principal.Claims.Role.AtLeast(role) {
+			respondWithError(w, http.StatusForbidden, "Requires the "+string(role)+" role")
+			return
+		}
+		next(w, r)
+	})
+}
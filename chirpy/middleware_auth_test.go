@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/auth"
+)
+
+func TestRequireAuthRejectsBadTokens(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("user@example.com", "password")
+
+	otherKeys, _ := auth.NewKeyring([]auth.Key{{ID: auth.LegacyKeyID, Secret: "other"}}, auth.LegacyKeyID)
+	forged, _ := auth.MakeJWT(accessClaims(user), auth.TokenConfig{Keys: otherKeys, Issuer: "chirpy", Audience: "chirpy"}, accessTokenTTL)
+	expired, _ := auth.MakeJWT(accessClaims(user), api.cfg.tokens, -accessTokenTTL)
+
+	for name, token := range map[string]string{
+		"missing": "",
+		"garbage": "not-a-jwt",
+		"forged":  forged,
+		"expired": expired,
+	} {
+		w := api.do("GET", "/api/sessions", token, nil)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s token: expected 401, got %d", name, w.Code)
+		}
+		if got := w.Header().Get("WWW-Authenticate"); got != `Bearer error="invalid_token"` {
+			t.Errorf("%s token: unexpected WWW-Authenticate %q", name, got)
+		}
+	}
+
+	w := api.do("GET", "/api/sessions", api.accessToken(user), nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected a valid token to get through, got %d", w.Code)
+	}
+}
+
+func TestRequireAuthChecksScope(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("user@example.com", "password")
+
+	claims := accessClaims(user)
+	claims.Scope = []string{auth.ScopeChirpsWrite}
+	token, _ := auth.MakeJWT(claims, api.cfg.tokens, accessTokenTTL)
+
+	w := api.do("GET", "/api/sessions", token, nil)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without the account scope, got %d", w.Code)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); got != `Bearer error="insufficient_scope", scope="account"` {
+		t.Errorf("unexpected WWW-Authenticate %q", got)
+	}
+	w = api.do("POST", "/api/chirps", token, map[string]string{"body": "hello"})
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected the chirps scope to allow chirping, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("user@example.com", "password")
+	admin := api.createUser("admin@example.com", "password")
+	admin.Role = string(auth.RoleAdmin)
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"user", api.accessToken(user), http.StatusForbidden},
+		{"admin", api.accessToken(admin), http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := api.do("GET", "/admin/users", tt.token, nil)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+}
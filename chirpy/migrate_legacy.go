@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+)
+
+// runMigrateLegacy imports a legacy _chirpy file. Only the JSON store can
+// import, so other drivers are refused rather than having JSON written over
+// their database file.
+func runMigrateLegacy(args []string) error {
+	driver, defaultPath := dbConfig()
+	flags := flag.NewFlagSet("migrate-legacy", flag.ExitOnError)
+	from := flags.String("from", "", "Path to the legacy _chirpy database file")
+	to := flags.String("to", defaultPath, "Path to the database.json to import into")
+	flags.Parse(args)
+
+	if *from == "" {
+		return errors.New("migrate-legacy: -from is required")
+	}
+	if driver != database.DriverJSON {
+		return fmt.Errorf("migrate-legacy: only the %q driver can import, not %q", database.DriverJSON, driver)
+	}
+
+	db, err := database.NewDB(*to)
+	if err != nil {
+		return err
+	}
+	report, err := db.ImportLegacy(*from)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("imported %d users and %d chirps from %s into %s\n", report.UsersImported, report.ChirpsImported, *from, *to)
+	for _, skipped := range report.Skipped {
+		fmt.Printf("skipped %s %s: %s\n", skipped.Kind, skipped.Key, skipped.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/Kristian-Roopnarine/chirpy/internal/database"
+)
+
+func runSnapshot(args []string) error {
+	driver, path := dbConfig()
+	policy, err := snapshotPolicy()
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	flags.StringVar(&policy.Dir, "dir", policy.Dir, "Directory to write the snapshot to")
+	list := flags.Bool("list", false, "List existing snapshots instead of taking one")
+	flags.Parse(args)
+
+	name := filepath.Base(path)
+	if *list {
+		snapshots, err := database.ListSnapshots(name, policy)
+		if err != nil {
+			return err
+		}
+		for _, snapshot := range snapshots {
+			fmt.Printf("%s\t%s\n", snapshot.CreatedAt.Format("2006-01-02 15:04:05"), snapshot.Path)
+		}
+		return nil
+	}
+
+	db, err := database.Open(driver, path)
+	if err != nil {
+		return err
+	}
+	snapshot, err := database.TakeSnapshot(db, name, policy)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote snapshot %s\n", snapshot.Path)
+	return nil
+}
+
+func runRestore(args []string) error {
+	driver, path := dbConfig()
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	from := flags.String("from", "", "Path to the snapshot to restore")
+	flags.Parse(args)
+
+	if *from == "" {
+		return errors.New("restore: -from is required")
+	}
+	err := database.RestoreSnapshot(driver, *from, path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored %s from %s\n", path, *from)
+	return nil
+}